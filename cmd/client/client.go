@@ -18,6 +18,12 @@ var (
 	jwt     = flag.String("jwt", "", "JWT for authentication")
 	lang    = flag.String("lang", "English", "Language for the haiku")
 	tags    = flag.String("tags", "", "Comma-separated list of tags for the haiku")
+	tone    = flag.String("tone", "auto", "Tone of the haiku (auto, playful, solemn, romantic, melancholic, minimalist)")
+	kigo    = flag.Bool("kigo", false, "Ask for a seasonal word (kigo) in the haiku")
+	season  = flag.String("season", "", "Season for the kigo (spring, summer, autumn, winter), derived from the current date if empty")
+	vary    = flag.Bool("vary", false, "Ask for a different haiku if the image was sent before")
+	detail  = flag.String("detail", "", "Image detail (auto, low, high); high needs the haiku:hd scope")
+	meta    = flag.Bool("meta", false, "Include token usage and estimated cost in the response")
 	port    = flag.String("port", "8080", "Port to run the server on")
 )
 
@@ -85,15 +91,34 @@ func tagList() []string {
 	return list
 }
 
+func onDuplicate() string {
+	if *vary {
+		return "vary"
+	}
+	return "reuse"
+}
+
 func reqBody(base64Image string, tagList []string) ([]byte, error) {
 	body := struct {
 		Base64Image string   `json:"base64Image"`
 		Language    string   `json:"language"`
 		Tags        []string `json:"tags"`
+		Tone        string   `json:"tone"`
+		Kigo        bool     `json:"kigo"`
+		Season      string   `json:"season,omitempty"`
+		OnDuplicate string   `json:"onDuplicate,omitempty"`
+		Detail      string   `json:"detail,omitempty"`
+		IncludeMeta bool     `json:"includeMeta"`
 	}{
 		Base64Image: base64Image,
 		Language:    *lang,
 		Tags:        tagList,
+		Tone:        *tone,
+		Kigo:        *kigo,
+		Season:      *season,
+		OnDuplicate: onDuplicate(),
+		Detail:      *detail,
+		IncludeMeta: *meta,
 	}
 
 	return json.Marshal(body)
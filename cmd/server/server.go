@@ -1,31 +1,42 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
-	"time"
+	"os"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 
-	// Blank-import the function package so the init() runs
-	_ "github.com/rd-martin-zoeller/img2haiku-backend"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/app"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/config"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
 )
 
-const (
-	sub      = "img2haiku-backend-demo"
-	aud      = "img2haiku-backend"
-	ttl      = 15 * time.Minute
-	hostname = "127.0.0.1"
-)
+const hostname = "127.0.0.1"
 
 var (
-	port = flag.String("port", "8080", "Port to run the server on")
+	port   = flag.String("port", "8080", "Port to run the server on")
+	keyAlg = flag.String("key-algorithm", jwt.RS256, "Algorithm of the generated key pair for testing: RS256, ES256 or EdDSA")
 )
 
 func main() {
-	flag.Parse()
+	cfg, err := config.LoadWithFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load the configuration: %v\n", err)
+	}
+	app.SetupLogging(cfg)
 
-	prepJWT()
+	cfg.JWT.PublicKey = prepJWT(cfg.JWT, *keyAlg)
+
+	// The function is registered here rather than by importing the function
+	// package, so that it verifies tokens with the generated key.
+	a, err := app.New(context.Background(), cfg)
+	if err != nil {
+		app.Fatal("Failed to set up the function", err)
+	}
+	functions.HTTP("ComposeHaiku", a.Handler.ServeHTTP)
 
 	log.Printf("Starting function framework on %s:%s\n", hostname, *port)
 
@@ -2,23 +2,32 @@ package main
 
 import (
 	"log"
-	"os"
+	"strings"
 
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/config"
 	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
 )
 
-func prepJWT() {
-	keyPair, err := jwt.GenKeyPair()
+// prepJWT generates a key pair for alg, prints a token for testing and
+// returns the public key that verifies it.
+func prepJWT(cfg config.JWT, alg string) string {
+	keyPair, err := jwt.GenKeyPairFor(alg)
 	if err != nil {
 		log.Fatalf("Failed to generate credentials: %v\n", err)
 	}
 
-	os.Setenv("JWT_SECRET", keyPair.Public)
+	var iss string
+	if len(cfg.Issuers) > 0 {
+		iss = cfg.Issuers[0]
+	}
+
 	jwt, err := jwt.JWTForTesting(jwt.JWTConfig{
 		KeyPair: keyPair,
-		Sub:     sub,
-		Aud:     aud,
-		Exp:     ttl,
+		Sub:     cfg.Subject,
+		Aud:     cfg.Audiences[0],
+		Iss:     iss,
+		Claims:  map[string]any{"scope": strings.Join(jwt.AllScopes, " ")},
+		Exp:     jwt.DefaultTTL,
 	})
 	if err != nil {
 		log.Fatalf("Could not generate JWT for testing: %v\n", err)
@@ -29,4 +38,5 @@ func prepJWT() {
 	}
 
 	log.Printf("+++++ JWT for testing +++++\n%s\n", jwt)
+	return keyPair.Public
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/app"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/config"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/server"
+)
+
+// closeTimeout bounds flushing spans and closing store connections.
+const closeTimeout = 10 * time.Second
+
+func main() {
+	cfg, err := config.LoadWithFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load the configuration: %v\n", err)
+	}
+	app.SetupLogging(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	a, err := app.New(ctx, cfg)
+	if err != nil {
+		app.Fatal("Failed to set up the server", err)
+	}
+
+	err = server.Run(ctx, a.Handler, cfg.ServerConfig())
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if closeErr := a.Close(closeCtx); closeErr != nil {
+		log.Printf("Failed to close the app: %v\n", closeErr)
+	}
+	if err != nil {
+		log.Fatalf("Server failed: %v\n", err)
+	}
+}
@@ -1,10 +1,11 @@
 #!/usr/bin/env bash
 set -euo pipefail
 
+# --base-image must provide the Go version of the go directive in go.mod.
 gcloud run deploy go-http-function \
     --source . \
     --function ComposeHaiku \
-    --base-image go123 \
+    --base-image go125 \
     --region europe-north2 \
     --env-vars-file=env.yaml \
     --allow-unauthenticated
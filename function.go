@@ -1,20 +1,28 @@
 package function
 
 import (
-	"net/http"
-	"os"
-	"time"
+	"context"
+	"log"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
-	"github.com/rd-martin-zoeller/img2haiku-backend/internal/compose"
-	"github.com/rd-martin-zoeller/img2haiku-backend/internal/openai"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/app"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/config"
 )
 
 func init() {
-	functions.HTTP("ComposeHaiku", compose.ComposeHaiku(&openai.OpenAiClient{
-		ApiKey: os.Getenv("OPENAI_API_KEY"),
-		Client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-	}))
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load the configuration: %v\n", err)
+	}
+	app.SetupLogging(cfg)
+
+	// The functions runtime offers no shutdown hook, so the app is never
+	// closed and spans still batched when an instance is stopped are lost.
+	a, err := app.New(context.Background(), cfg)
+	if err != nil {
+		app.Fatal("Failed to set up the function", err)
+	}
+
+	functions.HTTP("ComposeHaiku", a.Handler.ServeHTTP)
 }
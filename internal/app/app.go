@@ -0,0 +1,213 @@
+// Package app wires the compose handler and its dependencies from the
+// configuration, for both the Cloud Function and the standalone server.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/budget"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/cache"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/compose"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/config"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/logging"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/metrics"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/openai"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/quota"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/ratelimit"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/revocation"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/tracing"
+)
+
+// jwksTimeout bounds a fetch of the JWKS, which a request may wait for.
+const jwksTimeout = 5 * time.Second
+
+// App is the service's HTTP handler along with the resources it holds.
+type App struct {
+	Handler http.Handler
+
+	closers []func(context.Context) error
+}
+
+// SetupLogging installs the default logger as configured.
+func SetupLogging(cfg config.Config) {
+	slog.SetDefault(slog.New(logging.NewHandler(os.Stderr, logging.Options{
+		Format:    cfg.Log.Format,
+		Level:     cfg.LogLevel(),
+		ProjectID: cfg.Log.ProjectID,
+	})))
+}
+
+// New builds the handler from the configuration. It fails if secrets are
+// missing or malformed, so that a misconfigured instance never serves.
+func New(ctx context.Context, cfg config.Config) (*App, error) {
+	if err := cfg.CheckSecrets(); err != nil {
+		return nil, fmt.Errorf("missing or malformed secrets:\n%w", err)
+	}
+
+	verifierConfig := jwt.VerifierConfig{
+		PublicKey:      cfg.JWT.PublicKey,
+		Algorithms:     cfg.JWT.Algorithms,
+		Audiences:      cfg.JWT.Audiences,
+		Issuers:        cfg.JWT.Issuers,
+		RequiredClaims: cfg.JWT.RequiredClaims,
+		Leeway:         cfg.JWT.Leeway,
+		MaxAge:         cfg.JWT.MaxAge,
+	}
+	if cfg.JWT.JWKSURL != "" {
+		verifierConfig.JWKS = jwt.NewJWKS(jwt.JWKSConfig{
+			URL:     cfg.JWT.JWKSURL,
+			Refresh: cfg.JWT.JWKSRefresh,
+			Client:  &http.Client{Timeout: jwksTimeout, Transport: tracing.Transport(http.DefaultTransport)},
+		})
+		// An unreachable auth server must not keep the instance from
+		// starting; the keys are fetched again with the first token.
+		if err := verifierConfig.JWKS.Refresh(ctx); err != nil {
+			slog.WarnContext(ctx, "Failed to fetch the JWKS", "url", cfg.JWT.JWKSURL, "error", err)
+		}
+	}
+	verifier, err := jwt.NewVerifier(verifierConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the token verifier: %w", err)
+	}
+
+	app := &App{}
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter: cfg.Trace.Exporter,
+		Endpoint: cfg.Trace.OTLPEndpoint,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	app.closers = append(app.closers, shutdownTracing)
+
+	temperature := float32(cfg.OpenAI.Temperature)
+	client := &openai.OpenAiClient{
+		ApiKey: cfg.OpenAI.APIKey,
+		Client: &http.Client{
+			Timeout:   cfg.OpenAI.Timeout,
+			Transport: tracing.Transport(http.DefaultTransport),
+		},
+		Prices:      cfg.OpenAI.Prices,
+		APIURL:      cfg.OpenAI.APIURL,
+		Model:       cfg.OpenAI.Model,
+		MaxTokens:   cfg.OpenAI.MaxTokens,
+		Temperature: &temperature,
+	}
+
+	var store cache.Store
+	var limiter ratelimit.Limiter
+	var quotaStore quota.Store
+	var budgetStore budget.Store
+	var revocations revocation.Store
+	switch cfg.Store.Backend {
+	case config.StoreRedis:
+		opts, err := redis.ParseURL(cfg.Store.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		redisClient := redis.NewClient(opts)
+		app.closers = append(app.closers, func(context.Context) error { return redisClient.Close() })
+		store = cache.NewRedisStore(redisClient)
+		limiter = ratelimit.NewRedisTokenBucket(redisClient, cfg.RateLimitConfig())
+		quotaStore = quota.NewRedisStore(redisClient)
+		budgetStore = budget.NewRedisStore(redisClient)
+		revocations = revocation.NewRedisStore(redisClient)
+	default:
+		store = cache.NewLRU(cache.DefaultSize)
+		limiter = ratelimit.NewTokenBucket(cfg.RateLimitConfig())
+		quotaStore = quota.NewMemoryStore()
+		budgetStore = budget.NewMemoryStore()
+		if cfg.Store.QuotaFile != "" {
+			fileStore, err := quota.NewFileStore(cfg.Store.QuotaFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load QUOTA_FILE: %w", err)
+			}
+			app.closers = append(app.closers, func(context.Context) error { return fileStore.Close() })
+			quotaStore = fileStore
+		}
+		// Without Redis, revocations are kept per instance.
+		revocations = revocation.NewMemoryStore()
+		if cfg.JWT.RevocationFile != "" {
+			fileStore, err := revocation.NewFileStore(cfg.JWT.RevocationFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load JWT_REVOCATION_FILE: %w", err)
+			}
+			revocations = fileStore
+		}
+		if cfg.Admin.Token != "" || cfg.JWT.OneTimeTTL > 0 {
+			slog.InfoContext(ctx, "Revocations and used tokens are kept per instance; use the redis backend to share them")
+		}
+	}
+	if !slices.Contains(cfg.JWT.RequiredClaims, "jti") {
+		slog.WarnContext(ctx, "Tokens need no jti claim, so tokens without one cannot be revoked; add jti to JWT_REQUIRED_CLAIMS")
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	stats := metrics.New(registry)
+
+	upstream := budget.NewClient(metrics.NewClient(client, stats), budget.NewController(cfg.BudgetConfig(), budgetStore))
+	cached := cache.NewClient(upstream, store, cache.DefaultTTL)
+
+	opts := []compose.Option{
+		compose.WithVerifier(verifier),
+		compose.WithRateLimiter(limiter),
+		compose.WithQuota(quota.New(quotaStore, quota.DefaultPlans)),
+		compose.WithRevocation(revocations, cfg.JWT.OneTimeTTL),
+		compose.WithUpstreamTimeout(cfg.OpenAI.Timeout),
+	}
+	if cfg.JWT.EnforceScopes {
+		opts = append(opts, compose.WithScopeCheck())
+	} else {
+		slog.WarnContext(ctx, "Token scopes are not enforced, so every token may use the premium options; set JWT_ENFORCE_SCOPES=true in production")
+	}
+	handler := compose.ComposeHaiku(
+		cache.NewNearDuplicateClient(cached, cache.DefaultNearWindow, cache.DefaultNearThreshold),
+		opts...,
+	)
+
+	mux := http.NewServeMux()
+	if cfg.Admin.MetricsToken != "" {
+		mux.Handle("GET /metrics", metrics.Handler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}), cfg.Admin.MetricsToken))
+	}
+	if cfg.Admin.Token != "" {
+		mux.Handle("POST /admin/revocations", revocation.Handler(revocations, cfg.Admin.Token))
+	}
+	mux.Handle("/", stats.Middleware(http.HandlerFunc(handler)))
+
+	slog.InfoContext(ctx, "Loaded configuration", "config", cfg)
+
+	app.Handler = tracing.Handler(logging.Middleware(mux))
+	return app, nil
+}
+
+// Fatal logs err with the default logger, so that it shows up with error
+// severity, and exits.
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err.Error())
+	os.Exit(1)
+}
+
+// Close flushes pending spans and closes connections to the stores. It is
+// called once the handler has served its last request.
+func (a *App) Close(ctx context.Context) error {
+	var errs []error
+	for _, closer := range a.closers {
+		errs = append(errs, closer(ctx))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/config"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/logging"
+)
+
+// validConfig returns the defaults along with the required secrets.
+func validConfig(t *testing.T) config.Config {
+	t.Helper()
+
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.OpenAI.APIKey = "EXAMPLE_API_KEY"
+	cfg.JWT.PublicKey = keyPair.Public
+	return cfg
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "compose without token", method: http.MethodPost, path: "/", wantStatus: http.StatusUnauthorized},
+	}
+
+	a, err := New(context.Background(), validConfig(t))
+	if err != nil {
+		t.Fatalf("Failed to set up the app: %v", err)
+	}
+	defer a.Close(context.Background())
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(`{}`))
+			rec := httptest.NewRecorder()
+
+			a.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.wantStatus {
+				t.Errorf("Expected status %d, got %d", c.wantStatus, rec.Code)
+			}
+			if rec.Header().Get(logging.RequestIDHeader) == "" {
+				t.Errorf("Expected a request ID header")
+			}
+		})
+	}
+}
+
+func TestNewMissingSecrets(t *testing.T) {
+	cases := []struct {
+		name    string
+		modify  func(*config.Config)
+		wantErr string
+	}{
+		{name: "API key", modify: func(cfg *config.Config) { cfg.OpenAI.APIKey = "" }, wantErr: "OPENAI_API_KEY is not set"},
+		{name: "public key", modify: func(cfg *config.Config) { cfg.JWT.PublicKey = "EXAMPLE_PUBLIC_KEY" }, wantErr: "JWT_SECRET is not a usable public key"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			c.modify(&cfg)
+
+			_, err := New(context.Background(), cfg)
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewInvalidRedisURL(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Store.Backend = config.StoreRedis
+	cfg.Store.RedisURL = "EXAMPLE_REDIS_URL"
+
+	if _, err := New(context.Background(), cfg); err == nil {
+		t.Errorf("Expected an error for an invalid Redis URL")
+	}
+}
+
+func TestNewUnreachableJWKS(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	cfg := validConfig(t)
+	cfg.JWT.PublicKey = ""
+	cfg.JWT.JWKSURL = server.URL
+
+	a, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Expected the app to start without the JWKS, got %v", err)
+	}
+	defer a.Close(context.Background())
+}
+
+func TestNewAdminEndpoint(t *testing.T) {
+	cases := []struct {
+		name       string
+		adminToken string
+		wantStatus int
+	}{
+		{name: "enabled", adminToken: "EXAMPLE_ADMIN_TOKEN", wantStatus: http.StatusNoContent},
+		// The request reaches the compose handler, which rejects the token.
+		{name: "disabled", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			cfg.Admin.Token = c.adminToken
+
+			a, err := New(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Failed to set up the app: %v", err)
+			}
+			defer a.Close(context.Background())
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/revocations", strings.NewReader(`{"jti": "EXAMPLE_ID"}`))
+			req.Header.Set("Authorization", "Bearer EXAMPLE_ADMIN_TOKEN")
+			rec := httptest.NewRecorder()
+
+			a.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.wantStatus {
+				t.Errorf("Expected status %d, got %d", c.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestNewMetricsEndpoint(t *testing.T) {
+	cases := []struct {
+		name         string
+		metricsToken string
+		auth         string
+		wantStatus   int
+	}{
+		{name: "enabled", metricsToken: "EXAMPLE_METRICS_TOKEN", auth: "Bearer EXAMPLE_METRICS_TOKEN", wantStatus: http.StatusOK},
+		{name: "wrong token", metricsToken: "EXAMPLE_METRICS_TOKEN", auth: "Bearer EXAMPLE_OTHER_TOKEN", wantStatus: http.StatusUnauthorized},
+		// The request reaches the compose handler, which rejects the token.
+		{name: "disabled", auth: "Bearer EXAMPLE_METRICS_TOKEN", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			cfg.Admin.MetricsToken = c.metricsToken
+
+			a, err := New(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Failed to set up the app: %v", err)
+			}
+			defer a.Close(context.Background())
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Authorization", c.auth)
+			rec := httptest.NewRecorder()
+
+			a.Handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.wantStatus {
+				t.Errorf("Expected status %d, got %d", c.wantStatus, rec.Code)
+			}
+			if c.wantStatus == http.StatusOK && !strings.Contains(rec.Body.String(), "go_goroutines") {
+				t.Errorf("Expected the metrics, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewMalformedRevocationFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+	if err := os.WriteFile(path, []byte("EXAMPLE_ID"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cfg := validConfig(t)
+	cfg.JWT.RevocationFile = path
+
+	if _, err := New(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "JWT_REVOCATION_FILE") {
+		t.Errorf("Expected an error naming JWT_REVOCATION_FILE, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Config caps the estimated upstream spend in US dollars per UTC day and
+// month. A cap of zero means unlimited.
+type Config struct {
+	DailyCapUSD   float64
+	MonthlyCapUSD float64
+	// WarnAt lists fractions of a cap, e.g. 0.8, at which a warning is
+	// logged when the spend crosses them.
+	WarnAt []float64
+	// FallbackModel is used instead of rejecting requests once a cap is
+	// reached. Requests are rejected if it is empty.
+	FallbackModel string
+}
+
+var DefaultWarnAt = []float64{0.5, 0.8, 0.9}
+
+// Store keeps spend counters. Implementations must be safe for concurrent
+// use.
+type Store interface {
+	// Get returns the spend recorded for key, or zero if it does not exist.
+	Get(ctx context.Context, key string) (float64, error)
+	// Add adds amount to key and returns the new spend. The counter is
+	// dropped at expiresAt.
+	Add(ctx context.Context, key string, amount float64, expiresAt time.Time) (float64, error)
+}
+
+// Controller tracks the spend against the configured caps.
+//
+// The cost of a call is only known once it returns, so an estimate is
+// reserved before the call and settled afterwards. Concurrent calls cannot
+// all pass a cap that their reservations would exceed. The cap is still soft:
+// calls that cost more than the estimate can overshoot it a little, and
+// until the first call is recorded, nothing is reserved.
+type Controller struct {
+	config Config
+	store  Store
+	now    func() time.Time
+
+	mu sync.Mutex
+	// estimate is the average cost of recent calls.
+	estimate float64
+}
+
+// estimateWeight is the weight of the latest cost in the estimate.
+const estimateWeight = 0.2
+
+func NewController(config Config, store Store) *Controller {
+	return &Controller{config: config, store: store, now: time.Now}
+}
+
+type period struct {
+	name  string
+	key   string
+	cap   float64
+	reset time.Time
+}
+
+func (c *Controller) periods() []period {
+	now := c.now().UTC()
+	year, month, day := now.Date()
+
+	var periods []period
+	if c.config.DailyCapUSD > 0 {
+		periods = append(periods, period{
+			name:  "daily",
+			key:   fmt.Sprintf("day:%04d-%02d-%02d", year, month, day),
+			cap:   c.config.DailyCapUSD,
+			reset: time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	if c.config.MonthlyCapUSD > 0 {
+		periods = append(periods, period{
+			name:  "monthly",
+			key:   fmt.Sprintf("month:%04d-%02d", year, month),
+			cap:   c.config.MonthlyCapUSD,
+			reset: time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return periods
+}
+
+// Exhausted reports whether any cap has been reached.
+func (c *Controller) Exhausted(ctx context.Context) (bool, error) {
+	for _, p := range c.periods() {
+		spent, err := c.store.Get(ctx, p.key)
+		if err != nil {
+			return false, err
+		}
+		if spent >= p.cap {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Reserve adds the estimated cost of a call to the spend before the call is
+// made. If that reaches a cap, nothing is reserved and exhausted is true.
+// Every reservation must be settled with Settle.
+func (c *Controller) Reserve(ctx context.Context) (reserved float64, exhausted bool, err error) {
+	c.mu.Lock()
+	estimate := c.estimate
+	c.mu.Unlock()
+
+	periods := c.periods()
+	for i, p := range periods {
+		spent, err := c.store.Add(ctx, p.key, estimate, p.reset)
+		if err != nil {
+			c.undo(ctx, periods[:i], estimate)
+			return 0, false, err
+		}
+		if spent-estimate >= p.cap || (estimate > 0 && spent > p.cap) {
+			c.undo(ctx, periods[:i+1], estimate)
+			return 0, true, nil
+		}
+	}
+	return estimate, false, nil
+}
+
+// Settle replaces a reservation made with Reserve by the actual cost of the
+// call, which is zero if it failed, and logs a warning for every threshold or
+// cap the spend crosses.
+func (c *Controller) Settle(ctx context.Context, reserved, cost float64) error {
+	if cost > 0 {
+		c.mu.Lock()
+		if c.estimate == 0 {
+			c.estimate = cost
+		} else {
+			c.estimate += estimateWeight * (cost - c.estimate)
+		}
+		c.mu.Unlock()
+	}
+
+	return c.add(ctx, cost-reserved, cost)
+}
+
+func (c *Controller) undo(ctx context.Context, periods []period, amount float64) {
+	if amount == 0 {
+		return
+	}
+	for _, p := range periods {
+		if _, err := c.store.Add(ctx, p.key, -amount, p.reset); err != nil {
+			slog.ErrorContext(ctx, "Failed to take back spend reservation", "period", p.name, "error", err)
+		}
+	}
+}
+
+// Record adds cost to the spend and logs a warning for every threshold or cap
+// the spend crosses.
+func (c *Controller) Record(ctx context.Context, cost float64) error {
+	if cost <= 0 {
+		return nil
+	}
+	return c.add(ctx, cost, cost)
+}
+
+// add adds amount to the spend, which includes a call that cost cost, and
+// warns about the thresholds the call crossed.
+func (c *Controller) add(ctx context.Context, amount, cost float64) error {
+	if amount == 0 && cost <= 0 {
+		return nil
+	}
+
+	for _, p := range c.periods() {
+		spent, err := c.store.Add(ctx, p.key, amount, p.reset)
+		if err != nil {
+			return err
+		}
+
+		before := spent - cost
+		for _, fraction := range append(slices.Clone(c.config.WarnAt), 1) {
+			threshold := fraction * p.cap
+			if before < threshold && spent >= threshold {
+				slog.WarnContext(ctx, "Spend budget threshold reached",
+					"period", p.name,
+					"threshold", fraction,
+					"spentUsd", spent,
+					"capUsd", p.cap,
+				)
+			}
+		}
+	}
+	return nil
+}
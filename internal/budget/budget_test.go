@@ -0,0 +1,213 @@
+package budget
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+type fakeClient struct {
+	calls     int
+	lastModel string
+	cost      float64
+}
+
+func (c *fakeClient) Call(ctx context.Context, _, _ string) (types.Haiku, error) {
+	c.calls++
+	info, _ := types.CallInfoFromContext(ctx)
+	c.lastModel = info.Model
+	return types.Haiku{Haiku: "EXAMPLE_HAIKU", Meta: &types.Meta{EstimatedCostUSD: c.cost}}, nil
+}
+
+func TestController(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 31, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	controller := NewController(Config{DailyCapUSD: 1, MonthlyCapUSD: 1.5, WarnAt: []float64{0.5}}, store)
+	controller.now = func() time.Time { return now }
+
+	var logs bytes.Buffer
+	original := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(original) })
+
+	steps := []struct {
+		name          string
+		cost          float64
+		advance       time.Duration
+		wantExhausted bool
+		wantWarnings  int
+	}{
+		{name: "below all thresholds", cost: 0.4, wantExhausted: false, wantWarnings: 0},
+		{name: "daily warning threshold", cost: 0.2, wantExhausted: false, wantWarnings: 1},
+		{name: "daily cap and monthly warning threshold", cost: 0.5, wantExhausted: true, wantWarnings: 3},
+		{name: "next day and month reset the caps", advance: 24 * time.Hour, wantExhausted: false, wantWarnings: 3},
+		{name: "spend starts over", cost: 0.4, wantExhausted: false, wantWarnings: 3},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		if err := controller.Record(ctx, step.cost); err != nil {
+			t.Fatalf("%s: expected no error, got: %v", step.name, err)
+		}
+
+		exhausted, err := controller.Exhausted(ctx)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", step.name, err)
+		}
+		if exhausted != step.wantExhausted {
+			t.Errorf("%s: expected exhausted to be %v, got %v", step.name, step.wantExhausted, exhausted)
+		}
+		if warnings := strings.Count(logs.String(), "Spend budget threshold reached"); warnings != step.wantWarnings {
+			t.Errorf("%s: expected %d warnings, got %d:\n%s", step.name, step.wantWarnings, warnings, logs.String())
+		}
+	}
+}
+
+func TestControllerReserve(t *testing.T) {
+	ctx := context.Background()
+	controller := NewController(Config{DailyCapUSD: 1}, NewMemoryStore())
+
+	// The first call reserves nothing and sets the estimate.
+	reserved, exhausted, err := controller.Reserve(ctx)
+	if err != nil || exhausted || reserved != 0 {
+		t.Fatalf("Expected an empty reservation, got %v, exhausted=%v, err=%v", reserved, exhausted, err)
+	}
+	controller.Settle(ctx, reserved, 0.4)
+
+	// Two calls in flight would pass the cap together.
+	first, exhausted, _ := controller.Reserve(ctx)
+	if exhausted || first != 0.4 {
+		t.Fatalf("Expected a reservation of 0.4, got %v, exhausted=%v", first, exhausted)
+	}
+	if _, exhausted, _ := controller.Reserve(ctx); !exhausted {
+		t.Errorf("Expected the second reservation to exceed the cap")
+	}
+
+	// A failed call gives its reservation back.
+	controller.Settle(ctx, first, 0)
+	second, exhausted, _ := controller.Reserve(ctx)
+	if exhausted {
+		t.Fatalf("Expected the reservation to be given back")
+	}
+	controller.Settle(ctx, second, 0.4)
+
+	spent, _ := controller.store.Get(ctx, controller.periods()[0].key)
+	if spent < 0.79 || spent > 0.81 {
+		t.Errorf("Expected a spend of 0.8, got %v", spent)
+	}
+}
+
+func TestClient(t *testing.T) {
+	cases := []struct {
+		name          string
+		config        Config
+		wantCalls     int
+		wantModel     string
+		wantErrorCode types.ErrorCode
+	}{
+		{
+			name:      "within budget",
+			config:    Config{DailyCapUSD: 10},
+			wantCalls: 2,
+		},
+		{
+			name:          "exhausted budget rejects requests",
+			config:        Config{DailyCapUSD: 1},
+			wantCalls:     1,
+			wantErrorCode: types.ErrBudgetExhausted,
+		},
+		{
+			name:      "exhausted budget falls back to a cheaper model",
+			config:    Config{DailyCapUSD: 1, FallbackModel: "gpt-4o-mini"},
+			wantCalls: 2,
+			wantModel: "gpt-4o-mini",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			next := &fakeClient{cost: 1}
+			client := NewClient(next, NewController(c.config, NewMemoryStore()))
+			ctx := types.WithCallInfo(context.Background(), types.CallInfo{Language: "English"})
+
+			if _, err := client.Call(ctx, "EXAMPLE_PROMPT", "EXAMPLE_BASE64_IMAGE"); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			_, err := client.Call(ctx, "EXAMPLE_PROMPT", "EXAMPLE_BASE64_IMAGE")
+
+			var composeErr *types.ComposeError
+			if c.wantErrorCode != "" {
+				if !errors.As(err, &composeErr) || composeErr.Code != c.wantErrorCode {
+					t.Errorf("Expected error code %s, got %v", c.wantErrorCode, err)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+
+			if next.calls != c.wantCalls {
+				t.Errorf("Expected %d upstream calls, got %d", c.wantCalls, next.calls)
+			}
+			if next.lastModel != c.wantModel {
+				t.Errorf("Expected model %q, got %q", c.wantModel, next.lastModel)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 31, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	store.Add(ctx, "expiring", 1, now.Add(time.Second))
+	now = now.Add(2 * time.Second)
+
+	// The expired counter was not swept yet, but starts over.
+	if spent, _ := store.Add(ctx, "expiring", 0.5, now.Add(time.Second)); spent != 0.5 {
+		t.Errorf("Expected the expired spend to start over, got %v", spent)
+	}
+
+	now = now.Add(sweepInterval)
+	store.Add(ctx, "other", 1, now.Add(time.Hour))
+	if len(store.counters) != 1 {
+		t.Errorf("Expected expired counters to be swept, got %v", store.counters)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	store := NewRedisStore(client)
+	server.SetTime(time.Now())
+
+	store.Add(ctx, "key", 0.25, time.Now().Add(time.Hour))
+	if spent, err := store.Add(ctx, "key", 0.5, time.Now().Add(time.Hour)); err != nil || spent != 0.75 {
+		t.Fatalf("Expected spend 0.75, got %v, err=%v", spent, err)
+	}
+	if spent, _ := store.Get(ctx, "key"); spent != 0.75 {
+		t.Errorf("Expected spend 0.75, got %v", spent)
+	}
+
+	server.FastForward(2 * time.Hour)
+	if spent, _ := store.Get(ctx, "key"); spent != 0 {
+		t.Errorf("Expected expired spend 0, got %v", spent)
+	}
+}
@@ -0,0 +1,51 @@
+package budget
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/utils"
+)
+
+// Client is a types.Client decorator that stops upstream calls, or switches
+// them to the fallback model, once the budget is exhausted. It should wrap the
+// upstream client directly, so that cached haikus are still served.
+type Client struct {
+	next       types.Client
+	controller *Controller
+}
+
+func NewClient(next types.Client, controller *Controller) *Client {
+	return &Client{next: next, controller: controller}
+}
+
+func (c *Client) Call(ctx context.Context, prompt, base64Image string) (types.Haiku, error) {
+	reserved, exhausted, err := c.controller.Reserve(ctx)
+	if err != nil {
+		// Rather serve the request than fail because the store is unavailable.
+		slog.ErrorContext(ctx, "Failed to reserve spend budget", "error", err)
+	}
+
+	if exhausted {
+		if c.controller.config.FallbackModel == "" {
+			return types.Haiku{}, utils.NewErr(http.StatusServiceUnavailable, types.ErrBudgetExhausted, "%s", "The service has reached its spend budget, please try again later")
+		}
+
+		info, _ := types.CallInfoFromContext(ctx)
+		info.Model = c.controller.config.FallbackModel
+		ctx = types.WithCallInfo(ctx, info)
+	}
+
+	haiku, err := c.next.Call(ctx, prompt, base64Image)
+	var cost float64
+	if haiku.Meta != nil {
+		cost = haiku.Meta.EstimatedCostUSD
+	}
+	// The client may be gone, but the spend must still be settled.
+	if settleErr := c.controller.Settle(context.WithoutCancel(ctx), reserved, cost); settleErr != nil {
+		slog.ErrorContext(ctx, "Failed to record spend", "error", settleErr)
+	}
+	return haiku, err
+}
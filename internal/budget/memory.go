@@ -0,0 +1,72 @@
+package budget
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired counters are dropped.
+const sweepInterval = time.Minute
+
+type counter struct {
+	spent     float64
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-process Store. Its spend is not shared between
+// instances, so each instance enforces the caps on its own.
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]counter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]counter), now: time.Now}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok || !s.now().Before(c.expiresAt) {
+		return 0, nil
+	}
+	return c.spent, nil
+}
+
+func (s *MemoryStore) Add(_ context.Context, key string, amount float64, expiresAt time.Time) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	c := s.counters[key]
+	if !now.Before(c.expiresAt) {
+		// The counter expired but was not swept yet.
+		c = counter{}
+	}
+	c.spent += amount
+	c.expiresAt = expiresAt
+	s.counters[key] = c
+	return c.spent, nil
+}
+
+// sweep drops expired counters. It runs at most once per sweepInterval to keep
+// Add cheap.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for k, c := range s.counters {
+		if !now.Before(c.expiresAt) {
+			delete(s.counters, k)
+		}
+	}
+}
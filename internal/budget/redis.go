@@ -0,0 +1,39 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "img2haiku:budget:"
+
+// RedisStore is a Store backed by Redis, so that all instances share the same
+// spend.
+type RedisStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (float64, error) {
+	spent, err := s.client.Get(ctx, redisKeyPrefix+key).Float64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return spent, err
+}
+
+func (s *RedisStore) Add(ctx context.Context, key string, amount float64, expiresAt time.Time) (float64, error) {
+	pipe := s.client.TxPipeline()
+	incr := pipe.IncrByFloat(ctx, redisKeyPrefix+key, amount)
+	pipe.ExpireAt(ctx, redisKeyPrefix+key, expiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
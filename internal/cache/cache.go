@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+const (
+	// Header reports whether a response was served from the cache.
+	Header = "X-Cache"
+
+	DefaultSize = 1000
+	DefaultTTL  = 24 * time.Hour
+)
+
+// Store holds cached haikus by key. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	Get(ctx context.Context, key string) (types.Haiku, bool, error)
+	Set(ctx context.Context, key string, haiku types.Haiku, ttl time.Duration) error
+}
+
+// Client is a types.Client decorator that serves repeated requests for the
+// same image and options from a Store instead of calling the wrapped client.
+type Client struct {
+	next  types.Client
+	store Store
+	ttl   time.Duration
+}
+
+func NewClient(next types.Client, store Store, ttl time.Duration) *Client {
+	return &Client{next: next, store: store, ttl: ttl}
+}
+
+func (c *Client) Call(ctx context.Context, prompt, base64Image string) (types.Haiku, error) {
+	info, ok := types.CallInfoFromContext(ctx)
+	if !ok || info.NoCache {
+		return c.call(ctx, prompt, base64Image, types.CacheBypass)
+	}
+
+	image, err := base64.StdEncoding.DecodeString(base64Image)
+	if err != nil {
+		// Leave it to the upstream API to reject the image.
+		return c.call(ctx, prompt, base64Image, types.CacheBypass)
+	}
+
+	key := Key(info, image)
+	haiku, found, err := c.store.Get(ctx, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read from cache", "error", err)
+	}
+	if found {
+		haiku.Cache = types.CacheHit
+		haiku.Meta = nil
+		return haiku, nil
+	}
+
+	haiku, err = c.call(ctx, prompt, base64Image, types.CacheMiss)
+	if err != nil {
+		return haiku, err
+	}
+
+	if err := c.store.Set(ctx, key, haiku, c.ttl); err != nil {
+		slog.ErrorContext(ctx, "Failed to write to cache", "error", err)
+	}
+	return haiku, nil
+}
+
+func (c *Client) call(ctx context.Context, prompt, base64Image string, status types.CacheStatus) (types.Haiku, error) {
+	haiku, err := c.next.Call(ctx, prompt, base64Image)
+	haiku.Cache = status
+	return haiku, err
+}
+
+// Key identifies a compose request by its decoded image, normalized language,
+// sorted tags, the other prompt options and the prompt version.
+func Key(info types.CallInfo, image []byte) string {
+	imageSum := sha256.Sum256(image)
+	return hash(paramsKey(info), hex.EncodeToString(imageSum[:]))
+}
+
+// paramsKey identifies everything about a compose request except its image.
+func paramsKey(info types.CallInfo) string {
+	tags := make([]string, len(info.Tags))
+	for i, tag := range info.Tags {
+		tags[i] = normalize(tag)
+	}
+	slices.Sort(tags)
+
+	season := ""
+	if info.Kigo {
+		season = string(info.Season)
+	}
+
+	parts := []string{
+		info.PromptVersion,
+		normalize(info.Language),
+		strings.Join(tags, "\x1f"),
+		string(info.Tone),
+		season,
+	}
+	// Only a non-default detail is part of the key, so that the keys of
+	// earlier entries stay the same.
+	if info.Detail != "" && info.Detail != types.DetailAuto {
+		parts = append(parts, string(info.Detail))
+	}
+	return hash(parts...)
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
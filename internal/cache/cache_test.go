@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+type fakeClient struct {
+	calls      int
+	lastPrompt string
+}
+
+func (c *fakeClient) Call(_ context.Context, prompt, _ string) (types.Haiku, error) {
+	c.calls++
+	c.lastPrompt = prompt
+	return types.Haiku{Haiku: "EXAMPLE_HAIKU"}, nil
+}
+
+func TestClient(t *testing.T) {
+	image := base64.StdEncoding.EncodeToString([]byte("EXAMPLE_IMAGE"))
+	info := types.CallInfo{Language: "English", Tags: []string{"Beach", "Dog"}, PromptVersion: "1"}
+
+	cases := []struct {
+		name       string
+		infos      []*types.CallInfo
+		images     []string
+		wantStatus []types.CacheStatus
+		wantCalls  int
+	}{
+		{
+			name:       "repeated request is served from the cache",
+			infos:      []*types.CallInfo{&info, &info},
+			images:     []string{image, image},
+			wantStatus: []types.CacheStatus{types.CacheMiss, types.CacheHit},
+			wantCalls:  1,
+		},
+		{
+			name:       "tag order and case do not matter",
+			infos:      []*types.CallInfo{&info, {Language: " english", Tags: []string{"dog", "beach"}, PromptVersion: "1"}},
+			images:     []string{image, image},
+			wantStatus: []types.CacheStatus{types.CacheMiss, types.CacheHit},
+			wantCalls:  1,
+		},
+		{
+			name:       "different prompt version misses",
+			infos:      []*types.CallInfo{&info, {Language: "English", Tags: []string{"Beach", "Dog"}, PromptVersion: "2"}},
+			images:     []string{image, image},
+			wantStatus: []types.CacheStatus{types.CacheMiss, types.CacheMiss},
+			wantCalls:  2,
+		},
+		{
+			name:       "high detail misses",
+			infos:      []*types.CallInfo{&info, {Language: "English", Tags: []string{"Beach", "Dog"}, PromptVersion: "1", Detail: types.DetailHigh}},
+			images:     []string{image, image},
+			wantStatus: []types.CacheStatus{types.CacheMiss, types.CacheMiss},
+			wantCalls:  2,
+		},
+		{
+			name:       "auto detail is the default",
+			infos:      []*types.CallInfo{&info, {Language: "English", Tags: []string{"Beach", "Dog"}, PromptVersion: "1", Detail: types.DetailAuto}},
+			images:     []string{image, image},
+			wantStatus: []types.CacheStatus{types.CacheMiss, types.CacheHit},
+			wantCalls:  1,
+		},
+		{
+			name:       "no-cache bypasses the cache",
+			infos:      []*types.CallInfo{&info, {Language: "English", Tags: []string{"Beach", "Dog"}, PromptVersion: "1", NoCache: true}},
+			images:     []string{image, image},
+			wantStatus: []types.CacheStatus{types.CacheMiss, types.CacheBypass},
+			wantCalls:  2,
+		},
+		{
+			name:       "missing call info bypasses the cache",
+			infos:      []*types.CallInfo{nil, nil},
+			images:     []string{image, image},
+			wantStatus: []types.CacheStatus{types.CacheBypass, types.CacheBypass},
+			wantCalls:  2,
+		},
+		{
+			name:       "invalid base64 bypasses the cache",
+			infos:      []*types.CallInfo{&info, &info},
+			images:     []string{"%%%", "%%%"},
+			wantStatus: []types.CacheStatus{types.CacheBypass, types.CacheBypass},
+			wantCalls:  2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			next := &fakeClient{}
+			client := NewClient(next, NewLRU(10), time.Hour)
+
+			for i, info := range c.infos {
+				ctx := context.Background()
+				if info != nil {
+					ctx = types.WithCallInfo(ctx, *info)
+				}
+
+				haiku, err := client.Call(ctx, "EXAMPLE_PROMPT", c.images[i])
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				if haiku.Cache != c.wantStatus[i] {
+					t.Errorf("Call %d: expected cache status %s, got %s", i, c.wantStatus[i], haiku.Cache)
+				}
+				if haiku.Haiku != "EXAMPLE_HAIKU" {
+					t.Errorf("Call %d: expected haiku %q, got %q", i, "EXAMPLE_HAIKU", haiku.Haiku)
+				}
+			}
+
+			if next.calls != c.wantCalls {
+				t.Errorf("Expected %d upstream calls, got %d", c.wantCalls, next.calls)
+			}
+		})
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	lru := NewLRU(2)
+	lru.now = func() time.Time { return now }
+
+	lru.Set(ctx, "a", types.Haiku{Haiku: "A"}, time.Hour)
+	lru.Set(ctx, "b", types.Haiku{Haiku: "B"}, time.Hour)
+	lru.Get(ctx, "a")
+	lru.Set(ctx, "c", types.Haiku{Haiku: "C"}, time.Hour)
+
+	if _, found, _ := lru.Get(ctx, "b"); found {
+		t.Errorf("Expected least recently used entry to be evicted")
+	}
+	if haiku, found, _ := lru.Get(ctx, "a"); !found || haiku.Haiku != "A" {
+		t.Errorf("Expected recently used entry to be kept, got %+v", haiku)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, found, _ := lru.Get(ctx, "c"); found {
+		t.Errorf("Expected expired entry to be dropped")
+	}
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/imagehash"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+const (
+	DefaultNearWindow = 24 * time.Hour
+	// DefaultNearThreshold is the largest dHash distance, out of 64 bits, at
+	// which two images count as near-identical.
+	DefaultNearThreshold = 10
+	// DefaultNearMaxEntries bounds the remembered images of all subjects
+	// together, since the tags and other options make the number of scopes
+	// unbounded.
+	DefaultNearMaxEntries = 10000
+	// maxNearEntries bounds the remembered images per subject and options.
+	maxNearEntries = 50
+	// nearSweepInterval is how often images that left the window are dropped.
+	nearSweepInterval = time.Minute
+)
+
+const variationPrompt = `
+Important: The user has already received the following haiku for a near-identical image:
+%s
+Compose a noticeably different haiku, for example from another perspective or focusing on another detail, while following all of the rules above.
+`
+
+type nearEntry struct {
+	hash      uint64
+	haiku     types.Haiku
+	createdAt time.Time
+}
+
+// nearRef points to a remembered image, so that the oldest can be evicted.
+type nearRef struct {
+	scope     string
+	createdAt time.Time
+}
+
+// NearDuplicateClient is a types.Client decorator that recognizes images a
+// subject has sent before within a window, even when they have been
+// recompressed or resized. Depending on the request's duplicate policy, it
+// returns the earlier haiku or asks for a deliberately different one.
+type NearDuplicateClient struct {
+	next      types.Client
+	window    time.Duration
+	threshold int
+
+	mu      sync.Mutex
+	entries map[string][]nearEntry
+	// order holds a ref to every entry, oldest first. Refs to entries that
+	// were dropped otherwise stay until they are evicted or swept.
+	order      []nearRef
+	maxEntries int
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+func NewNearDuplicateClient(next types.Client, window time.Duration, threshold int) *NearDuplicateClient {
+	return &NearDuplicateClient{
+		next:       next,
+		window:     window,
+		threshold:  threshold,
+		entries:    make(map[string][]nearEntry),
+		maxEntries: DefaultNearMaxEntries,
+		now:        time.Now,
+	}
+}
+
+func (c *NearDuplicateClient) Call(ctx context.Context, prompt, base64Image string) (types.Haiku, error) {
+	info, ok := types.CallInfoFromContext(ctx)
+	if !ok {
+		return c.next.Call(ctx, prompt, base64Image)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(base64Image)
+	if err != nil {
+		return c.next.Call(ctx, prompt, base64Image)
+	}
+	img, err := imagehash.Decode(data)
+	if err != nil {
+		return c.next.Call(ctx, prompt, base64Image)
+	}
+
+	imageHash := imagehash.DHash(img)
+	scope := hash(info.Subject, paramsKey(info))
+
+	earlier, found := c.find(scope, imageHash)
+	switch {
+	case found && info.OnDuplicate == types.DuplicateVary:
+		prompt += fmt.Sprintf(variationPrompt, earlier.Haiku)
+	case found && !info.NoCache:
+		earlier.Cache = types.CacheNearHit
+		earlier.Meta = nil
+		return earlier, nil
+	}
+
+	haiku, err := c.next.Call(ctx, prompt, base64Image)
+	if err != nil {
+		return haiku, err
+	}
+
+	c.remember(scope, imageHash, haiku)
+	return haiku, nil
+}
+
+// find returns the most recent haiku for an image close to imageHash.
+func (c *NearDuplicateClient) find(scope string, imageHash uint64) (types.Haiku, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := c.now().Add(-c.window)
+	entries := c.entries[scope]
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.createdAt.Before(cutoff) {
+			break
+		}
+		if imagehash.Distance(entry.hash, imageHash) <= c.threshold {
+			return entry.haiku, true
+		}
+	}
+	return types.Haiku{}, false
+}
+
+func (c *NearDuplicateClient) remember(scope string, imageHash uint64, haiku types.Haiku) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.sweep(now)
+
+	entries := append(c.entries[scope], nearEntry{hash: imageHash, haiku: haiku, createdAt: now})
+	if len(entries) > maxNearEntries {
+		entries = entries[len(entries)-maxNearEntries:]
+	}
+	c.entries[scope] = entries
+
+	c.order = append(c.order, nearRef{scope: scope, createdAt: now})
+	for len(c.order) > c.maxEntries {
+		c.evictOldest()
+	}
+}
+
+// evictOldest drops the oldest ref along with its entry, unless the entry is
+// gone already.
+func (c *NearDuplicateClient) evictOldest() {
+	ref := c.order[0]
+	c.order = c.order[1:]
+
+	entries := c.entries[ref.scope]
+	if len(entries) == 0 || entries[0].createdAt.After(ref.createdAt) {
+		return
+	}
+	if len(entries) == 1 {
+		delete(c.entries, ref.scope)
+	} else {
+		c.entries[ref.scope] = entries[1:]
+	}
+}
+
+// sweep drops entries that have left the window. It runs at most once per
+// nearSweepInterval to keep remember cheap.
+func (c *NearDuplicateClient) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < nearSweepInterval {
+		return
+	}
+	c.lastSweep = now
+
+	cutoff := now.Add(-c.window)
+	i := 0
+	for i < len(c.order) && c.order[i].createdAt.Before(cutoff) {
+		i++
+	}
+	c.order = c.order[i:]
+
+	for scope, entries := range c.entries {
+		i := 0
+		for i < len(entries) && entries[i].createdAt.Before(cutoff) {
+			i++
+		}
+		if i == len(entries) {
+			delete(c.entries, scope)
+		} else {
+			c.entries[scope] = entries[i:]
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+func jpegImage(t *testing.T, width, height, quality int, invert bool) string {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(x * 255 / width)
+			if (y*4/height)%2 == 1 {
+				v = 255 - v
+			}
+			if invert {
+				v = 255 - v
+			}
+			img.Set(x, y, color.Gray{Y: v})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestNearDuplicateClient(t *testing.T) {
+	original := jpegImage(t, 320, 240, 90, false)
+	recompressed := jpegImage(t, 160, 120, 30, false)
+	different := jpegImage(t, 320, 240, 90, true)
+
+	alice := types.CallInfo{Subject: "alice", Language: "English", OnDuplicate: types.DuplicateReuse}
+	bob := types.CallInfo{Subject: "bob", Language: "English", OnDuplicate: types.DuplicateReuse}
+	aliceVary := types.CallInfo{Subject: "alice", Language: "English", OnDuplicate: types.DuplicateVary}
+	aliceGerman := types.CallInfo{Subject: "alice", Language: "German", OnDuplicate: types.DuplicateReuse}
+
+	cases := []struct {
+		name           string
+		infos          []types.CallInfo
+		images         []string
+		wantStatus     []types.CacheStatus
+		wantCalls      int
+		wantVariation  bool
+		advanceBetween time.Duration
+	}{
+		{
+			name:       "near-identical image is reused",
+			infos:      []types.CallInfo{alice, alice},
+			images:     []string{original, recompressed},
+			wantStatus: []types.CacheStatus{"", types.CacheNearHit},
+			wantCalls:  1,
+		},
+		{
+			name:          "near-identical image is varied on request",
+			infos:         []types.CallInfo{alice, aliceVary},
+			images:        []string{original, recompressed},
+			wantStatus:    []types.CacheStatus{"", ""},
+			wantCalls:     2,
+			wantVariation: true,
+		},
+		{
+			name:       "different image is composed",
+			infos:      []types.CallInfo{alice, alice},
+			images:     []string{original, different},
+			wantStatus: []types.CacheStatus{"", ""},
+			wantCalls:  2,
+		},
+		{
+			name:       "other subjects do not share haikus",
+			infos:      []types.CallInfo{alice, bob},
+			images:     []string{original, recompressed},
+			wantStatus: []types.CacheStatus{"", ""},
+			wantCalls:  2,
+		},
+		{
+			name:       "other options do not share haikus",
+			infos:      []types.CallInfo{alice, aliceGerman},
+			images:     []string{original, recompressed},
+			wantStatus: []types.CacheStatus{"", ""},
+			wantCalls:  2,
+		},
+		{
+			name:           "images outside the window are composed",
+			infos:          []types.CallInfo{alice, alice},
+			images:         []string{original, recompressed},
+			wantStatus:     []types.CacheStatus{"", ""},
+			wantCalls:      2,
+			advanceBetween: 2 * time.Hour,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+			next := &fakeClient{}
+			client := NewNearDuplicateClient(next, time.Hour, DefaultNearThreshold)
+			client.now = func() time.Time { return now }
+
+			for i, info := range c.infos {
+				haiku, err := client.Call(types.WithCallInfo(context.Background(), info), "EXAMPLE_PROMPT", c.images[i])
+				if err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				if haiku.Cache != c.wantStatus[i] {
+					t.Errorf("Call %d: expected cache status %q, got %q", i, c.wantStatus[i], haiku.Cache)
+				}
+				now = now.Add(c.advanceBetween)
+			}
+
+			if next.calls != c.wantCalls {
+				t.Errorf("Expected %d upstream calls, got %d", c.wantCalls, next.calls)
+			}
+
+			if variation := strings.Contains(next.lastPrompt, "EXAMPLE_HAIKU"); variation != c.wantVariation {
+				t.Errorf("Expected variation prompt to be %v, got prompt: %s", c.wantVariation, next.lastPrompt)
+			}
+		})
+	}
+}
+
+func TestNearDuplicateClientMaxEntries(t *testing.T) {
+	image := jpegImage(t, 320, 240, 90, false)
+	next := &fakeClient{}
+	client := NewNearDuplicateClient(next, time.Hour, DefaultNearThreshold)
+	client.maxEntries = 2
+
+	// Every set of tags is a scope of its own.
+	call := func(tags string) types.Haiku {
+		info := types.CallInfo{Subject: "alice", Language: "English", Tags: []string{tags}, OnDuplicate: types.DuplicateReuse}
+		haiku, err := client.Call(types.WithCallInfo(context.Background(), info), "EXAMPLE_PROMPT", image)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return haiku
+	}
+	call("EXAMPLE_TAG_1")
+	call("EXAMPLE_TAG_2")
+	call("EXAMPLE_TAG_3")
+
+	if len(client.entries) != 2 {
+		t.Errorf("Expected 2 remembered images, got %d", len(client.entries))
+	}
+	if haiku := call("EXAMPLE_TAG_1"); haiku.Cache != "" {
+		t.Errorf("Expected the oldest image to be evicted, got cache status %q", haiku.Cache)
+	}
+	if haiku := call("EXAMPLE_TAG_3"); haiku.Cache != types.CacheNearHit {
+		t.Errorf("Expected the newest image to be remembered, got cache status %q", haiku.Cache)
+	}
+}
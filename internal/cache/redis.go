@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+const redisKeyPrefix = "img2haiku:cache:"
+
+// RedisStore is a Store backed by Redis, so that all instances share the same
+// cached haikus. Redis evicts entries through their TTL.
+type RedisStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (types.Haiku, bool, error) {
+	var haiku types.Haiku
+
+	data, err := s.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return haiku, false, nil
+	}
+	if err != nil {
+		return haiku, false, err
+	}
+
+	if err := json.Unmarshal(data, &haiku); err != nil {
+		return haiku, false, err
+	}
+	return haiku, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, haiku types.Haiku, ttl time.Duration) error {
+	data, err := json.Marshal(haiku)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, redisKeyPrefix+key, data, ttl).Err()
+}
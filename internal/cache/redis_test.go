@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	store := NewRedisStore(client)
+
+	if _, found, err := store.Get(ctx, "key"); err != nil || found {
+		t.Fatalf("Expected missing key, got found=%v err=%v", found, err)
+	}
+
+	want := types.Haiku{Title: "EXAMPLE_TITLE", Haiku: "EXAMPLE_HAIKU", Cache: types.CacheMiss}
+	if err := store.Set(ctx, "key", want, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	got, found, err := store.Get(ctx, "key")
+	if err != nil || !found {
+		t.Fatalf("Expected stored key, got found=%v err=%v", found, err)
+	}
+	if got.Title != want.Title || got.Haiku != want.Haiku {
+		t.Errorf("Expected haiku %+v, got %+v", want, got)
+	}
+	if got.Cache != "" {
+		t.Errorf("Expected cache status not to be stored, got %q", got.Cache)
+	}
+
+	server.FastForward(2 * time.Hour)
+	if _, found, _ := store.Get(ctx, "key"); found {
+		t.Errorf("Expected expired key to be gone")
+	}
+}
+
+func TestClientWithRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	ctx := types.WithCallInfo(context.Background(), types.CallInfo{Language: "English", PromptVersion: "1"})
+	image := base64.StdEncoding.EncodeToString([]byte("EXAMPLE_IMAGE"))
+
+	// Two instances sharing the same Redis share the same cache.
+	next := &fakeClient{}
+	first := NewClient(next, NewRedisStore(client), time.Hour)
+	second := NewClient(next, NewRedisStore(client), time.Hour)
+
+	if haiku, _ := first.Call(ctx, "EXAMPLE_PROMPT", image); haiku.Cache != types.CacheMiss {
+		t.Errorf("Expected cache status %s, got %s", types.CacheMiss, haiku.Cache)
+	}
+	if haiku, _ := second.Call(ctx, "EXAMPLE_PROMPT", image); haiku.Cache != types.CacheHit {
+		t.Errorf("Expected cache status %s, got %s", types.CacheHit, haiku.Cache)
+	}
+	if next.calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", next.calls)
+	}
+}
@@ -1,74 +1,468 @@
 package compose
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/cache"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/idempotency"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/logging"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/quota"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/ratelimit"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/revocation"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/tracing"
 	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/utils"
 )
 
-func ComposeHaiku(client types.Client) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		composeHaiku(client, w, r)
+type handler struct {
+	client         types.Client
+	verifier       *jwt.Verifier
+	idempotency    idempotency.Store
+	idempotencyTTL time.Duration
+	limiter        ratelimit.Limiter
+	quota          *quota.Quota
+	checkScopes    bool
+	revocations    revocation.Store
+	oneTimeTTL     time.Duration
+	inFlightTTL    time.Duration
+}
+
+type Option func(*handler)
+
+// WithVerifier sets the verifier for the tokens in the Authorization header.
+// Without it, every request fails.
+func WithVerifier(verifier *jwt.Verifier) Option {
+	return func(h *handler) {
+		h.verifier = verifier
+	}
+}
+
+// WithScopeCheck requires the token to grant the scopes in internal/jwt for
+// the endpoint and for premium options. Without it, any valid token may use
+// everything.
+func WithScopeCheck() Option {
+	return func(h *handler) {
+		h.checkScopes = true
+	}
+}
+
+// WithRevocation rejects tokens whose jti was revoked in store. Tokens that
+// live at most oneTimeTTL may only be used once; zero allows every token to be
+// reused. Without it, tokens are valid until they expire.
+func WithRevocation(store revocation.Store, oneTimeTTL time.Duration) Option {
+	return func(h *handler) {
+		h.revocations = store
+		h.oneTimeTTL = oneTimeTTL
+	}
+}
+
+// WithIdempotencyStore replaces the default in-memory idempotency store.
+func WithIdempotencyStore(store idempotency.Store, ttl time.Duration) Option {
+	return func(h *handler) {
+		h.idempotency = store
+		h.idempotencyTTL = ttl
+	}
+}
+
+// WithUpstreamTimeout keeps idempotency keys reserved for as long as a
+// request with an upstream call of up to timeout may take. Without it, they
+// are reserved for idempotency.InFlightTTL.
+func WithUpstreamTimeout(timeout time.Duration) Option {
+	return func(h *handler) {
+		h.inFlightTTL = idempotency.InFlightTTLFor(timeout)
+	}
+}
+
+// WithRateLimiter limits requests per JWT subject. Without it, requests are
+// not rate limited.
+func WithRateLimiter(limiter ratelimit.Limiter) Option {
+	return func(h *handler) {
+		h.limiter = limiter
 	}
 }
 
-func composeHaiku(client types.Client, w http.ResponseWriter, r *http.Request) {
+// WithQuota enforces daily and monthly quotas per JWT subject. Without it,
+// there are no quotas.
+func WithQuota(q *quota.Quota) Option {
+	return func(h *handler) {
+		h.quota = q
+	}
+}
+
+func ComposeHaiku(client types.Client, opts ...Option) func(w http.ResponseWriter, r *http.Request) {
+	h := &handler{
+		client:         client,
+		idempotency:    idempotency.NewMemoryStore(),
+		idempotencyTTL: idempotency.DefaultTTL,
+		inFlightTTL:    idempotency.InFlightTTL,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h.composeHaiku
+}
+
+func (h *handler) composeHaiku(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	req, err := validateRequest(r)
+	input, err := validateRequest(w, r, h.verifier)
+	if err != nil {
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
+		return
+	}
+	// From here on, everything that gets the context knows the caller.
+	r = r.WithContext(jwt.WithClaims(r.Context(), input.Claims))
+
+	if err := h.checkRevocation(r.Context(), input.Claims); err != nil {
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
+		return
+	}
+
+	if h.checkScopes {
+		if err := authorize(input.Claims, input.ComposeRequest); err != nil {
+			writeError(r.Context(), w, err)
+			logError(r.Context(), err)
+			return
+		}
+	}
+
+	if err := h.checkRateLimit(r.Context(), input.Claims.Subject); err != nil {
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
+		return
+	}
+
+	if key := r.Header.Get(idempotency.Header); key != "" {
+		h.composeIdempotent(w, r, input, key)
+		return
+	}
+
+	h.compose(w, r, input)
+}
+
+func (h *handler) compose(w http.ResponseWriter, r *http.Request, input composeInput) {
+	_, span := tracing.Start(r.Context(), "compose.prompt")
+	prompt, err := makePrompt(input.ComposeRequest)
+	tracing.End(span, err)
 	if err != nil {
-		writeError(w, err)
-		logError(err)
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
+		return
+	}
+
+	if err := h.checkUnused(r.Context(), input.Claims); err != nil {
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
 		return
 	}
 
-	prompt, err := makePrompt(req.Language, req.Tags)
+	reserved, err := h.reserveQuota(r.Context(), w, input.Claims)
 	if err != nil {
-		writeError(w, err)
-		logError(err)
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
 		return
 	}
 
-	haiku, err := client.Call(r.Context(), prompt, req.Base64Image)
+	ctx := types.WithCallInfo(r.Context(), types.CallInfo{
+		Subject:       input.Claims.Subject,
+		Language:      input.Language,
+		Tags:          input.Tags,
+		Tone:          input.Tone,
+		Kigo:          input.Kigo,
+		Season:        input.Season,
+		OnDuplicate:   input.OnDuplicate,
+		Detail:        input.Detail,
+		PromptVersion: promptVersion,
+		// A deliberate variation must not be answered from the exact cache.
+		NoCache: noCache(r) || input.OnDuplicate == types.DuplicateVary,
+	})
+
+	haiku, err := h.client.Call(ctx, prompt, input.Base64Image)
+	if err == nil {
+		err = h.useToken(r.Context(), input.Claims)
+	}
+	if haiku.Cache != "" {
+		w.Header().Set(cache.Header, string(haiku.Cache))
+	}
+	// Failed calls and haikus from the cache cost nothing upstream, so
+	// they do not count against the quota.
+	if reserved && (err != nil || haiku.Cache == types.CacheHit || haiku.Cache == types.CacheNearHit) {
+		h.releaseQuota(r.Context(), w, input.Claims)
+	}
 	if err != nil {
-		writeError(w, err)
-		logError(err)
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
 		return
 	}
+	haiku.Tone = input.Tone
+	if input.Kigo {
+		haiku.Season = input.Season
+	} else {
+		haiku.Kigo = ""
+	}
+
+	if !input.IncludeMeta {
+		haiku.Meta = nil
+	} else if haiku.Meta == nil {
+		// Served without an upstream call, so nothing was spent.
+		haiku.Meta = &types.Meta{}
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(haiku)
 }
 
-func writeError(w http.ResponseWriter, err error) {
+// checkRevocation rejects revoked tokens. Unlike the rate limit, it fails
+// closed, since a stolen token must not be served just because the store is
+// unavailable.
+func (h *handler) checkRevocation(ctx context.Context, claims jwt.Claims) error {
+	if h.revocations == nil {
+		return nil
+	}
+
+	if claims.ID == "" {
+		if h.isOneTime(claims) {
+			return utils.NewErr(http.StatusUnauthorized, types.ErrAuthMissingClaim, "%s", "Token has no jti claim, which tokens that may only be used once need")
+		}
+		// Only tokens with a jti can be revoked.
+		return nil
+	}
+
+	revoked, err := h.revocations.Revoked(ctx, claims.ID)
+	if err != nil {
+		return utils.NewInternalErr("Failed to check token revocation: %s", err.Error())
+	}
+	if revoked {
+		return utils.NewErr(http.StatusUnauthorized, types.ErrAuthRevoked, "%s", "Token was revoked")
+	}
+	return nil
+}
+
+// checkUnused rejects one-time tokens that were already used, before the
+// request costs anything. It only runs once a request gets to compose, so
+// that retrying an idempotent request replays its response.
+func (h *handler) checkUnused(ctx context.Context, claims jwt.Claims) error {
+	if h.revocations == nil || claims.ID == "" || !h.isOneTime(claims) {
+		return nil
+	}
+
+	used, err := h.revocations.Used(ctx, claims.ID)
+	if err != nil {
+		return utils.NewInternalErr("Failed to check token use: %s", err.Error())
+	}
+	if used {
+		return utils.NewErr(http.StatusUnauthorized, types.ErrAuthRevoked, "%s", "Token was already used")
+	}
+	return nil
+}
+
+// useToken marks a one-time token as used once its haiku was composed, so
+// that failed requests can be retried with it. Of concurrent requests with
+// the same token, only the first gets its haiku.
+func (h *handler) useToken(ctx context.Context, claims jwt.Claims) error {
+	if h.revocations == nil || claims.ID == "" || !h.isOneTime(claims) {
+		return nil
+	}
+
+	// The client may be gone, but the token must still be marked.
+	first, err := h.revocations.Use(context.WithoutCancel(ctx), claims.ID, claims.ExpiresAt)
+	if err != nil {
+		return utils.NewInternalErr("Failed to mark token as used: %s", err.Error())
+	}
+	if !first {
+		return utils.NewErr(http.StatusUnauthorized, types.ErrAuthRevoked, "%s", "Token was revoked or already used")
+	}
+	return nil
+}
+
+// isOneTime reports whether the token lives short enough to be used only
+// once. Without iat, the remaining lifetime counts.
+func (h *handler) isOneTime(claims jwt.Claims) bool {
+	if h.oneTimeTTL <= 0 || claims.ExpiresAt.IsZero() {
+		return false
+	}
+	issuedAt := claims.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	return claims.ExpiresAt.Sub(issuedAt) <= h.oneTimeTTL
+}
+
+func (h *handler) checkRateLimit(ctx context.Context, subject string) error {
+	if h.limiter == nil {
+		return nil
+	}
+
+	decision, err := h.limiter.Allow(ctx, subject)
+	if err != nil {
+		// Rather serve the request than fail because the limiter is unavailable.
+		logError(ctx, utils.NewInternalErr("Failed to check rate limit: %s", err.Error()))
+		return nil
+	}
+
+	if !decision.Allowed {
+		retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+		return &types.ComposeError{
+			StatusCode: http.StatusTooManyRequests,
+			Code:       types.ErrRateLimited,
+			Details:    fmt.Sprintf("Too many requests, retry in %d seconds", retryAfter),
+			Header:     http.Header{"Retry-After": {strconv.Itoa(retryAfter)}},
+		}
+	}
+
+	return nil
+}
+
+// reserveQuota reserves a haiku of the subject's quota, or rejects the
+// request if the subject has used it up. It reports whether a haiku was
+// reserved.
+func (h *handler) reserveQuota(ctx context.Context, w http.ResponseWriter, claims jwt.Claims) (bool, error) {
+	if h.quota == nil {
+		return false, nil
+	}
+
+	result, err := h.quota.Reserve(ctx, claims.Subject, claims.Plan)
+	if err != nil {
+		logError(ctx, utils.NewInternalErr("Failed to reserve quota: %s", err.Error()))
+		return false, nil
+	}
+
+	setQuotaHeaders(w, result)
+	if !result.Allowed {
+		return false, utils.NewErr(http.StatusTooManyRequests, types.ErrQuotaExceeded, "Quota exceeded, it resets at %s", result.Reset.Format(time.RFC3339))
+	}
+
+	return result.Limited, nil
+}
+
+// releaseQuota gives back a reserved haiku that was not composed upstream.
+func (h *handler) releaseQuota(ctx context.Context, w http.ResponseWriter, claims jwt.Claims) {
+	// The client may be gone, but the haiku must still be given back.
+	result, err := h.quota.Release(context.WithoutCancel(ctx), claims.Subject, claims.Plan)
+	if err != nil {
+		logError(ctx, utils.NewInternalErr("Failed to release quota: %s", err.Error()))
+		return
+	}
+
+	setQuotaHeaders(w, result)
+}
+
+func setQuotaHeaders(w http.ResponseWriter, result quota.Result) {
+	if !result.Limited {
+		return
+	}
+	w.Header().Set(quota.RemainingHeader, strconv.Itoa(result.Remaining))
+	w.Header().Set(quota.ResetHeader, strconv.FormatInt(result.Reset.Unix(), 10))
+}
+
+// composeIdempotent replays the stored response for a repeated idempotency
+// key, or composes and stores the response for a new one. Server errors are
+// not stored so that the client can retry them.
+func (h *handler) composeIdempotent(w http.ResponseWriter, r *http.Request, input composeInput, key string) {
+	if len(key) > idempotency.MaxKeyLength {
+		err := utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "%s header must not be longer than %d characters", idempotency.Header, idempotency.MaxKeyLength)
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
+		return
+	}
+
+	storeKey := idempotency.Key(input.Claims.Subject, key)
+	fingerprint := idempotency.Fingerprint(input.Body)
+
+	record, reserved, err := h.idempotency.Reserve(r.Context(), storeKey, fingerprint, h.inFlightTTL)
+	if err != nil {
+		err = utils.NewInternalErr("Failed to reserve idempotency key: %s", err.Error())
+		writeError(r.Context(), w, err)
+		logError(r.Context(), err)
+		return
+	}
+
+	if !reserved {
+		switch {
+		case record.Fingerprint != fingerprint:
+			writeError(r.Context(), w, utils.NewErr(http.StatusUnprocessableEntity, types.ErrIdempotencyKeyReused, "%s was already used for a different request", idempotency.Header))
+		case record.Response == nil:
+			writeError(r.Context(), w, utils.NewErr(http.StatusConflict, types.ErrIdempotencyInProgress, "A request with this %s is still in progress", idempotency.Header))
+		default:
+			record.Response.Replay(w)
+		}
+		return
+	}
+
+	recorder := idempotency.NewRecorder(w)
+	h.compose(recorder, r, input)
+
+	// The client may be gone by now, but the outcome must still be stored.
+	ctx := context.WithoutCancel(r.Context())
+	response := recorder.Response()
+	if response.StatusCode >= http.StatusInternalServerError {
+		err = h.idempotency.Release(ctx, storeKey)
+	} else {
+		err = h.idempotency.Complete(ctx, storeKey, response, h.idempotencyTTL)
+	}
+	if err != nil {
+		logError(ctx, utils.NewInternalErr("Failed to store idempotent response: %s", err.Error()))
+	}
+}
+
+// noCache reports whether the client asked to bypass cached results.
+func noCache(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "no-store":
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(ctx context.Context, w http.ResponseWriter, err error) {
 	var composeErr *types.ComposeError
 	if errors.As(err, &composeErr) {
+		for name, values := range composeErr.Header {
+			w.Header()[name] = values
+		}
 		w.WriteHeader(composeErr.StatusCode)
 		errorResponse := types.ErrorResponse{
-			Code:    composeErr.Code,
-			Details: composeErr.Details,
+			Code:      composeErr.Code,
+			Details:   composeErr.Details,
+			RequestID: logging.RequestID(ctx),
 		}
 		json.NewEncoder(w).Encode(errorResponse)
 	} else {
 		w.WriteHeader(http.StatusInternalServerError)
 		errorResponse := types.ErrorResponse{
-			Code:    types.ErrInternalError,
-			Details: "An unexpected error occurred: " + err.Error(),
+			Code:      types.ErrInternalError,
+			Details:   "An unexpected error occurred: " + err.Error(),
+			RequestID: logging.RequestID(ctx),
 		}
 		json.NewEncoder(w).Encode(errorResponse)
 	}
 }
 
-func logError(err error) {
+func logError(ctx context.Context, err error) {
 	var composeErr *types.ComposeError
 	if errors.As(err, &composeErr) {
-		if composeErr.Code == types.ErrInternalError || composeErr.Code == types.ErrInvalidRequest {
-			log.Printf("Encountered a compose error: %+v", err)
+		switch composeErr.Code {
+		case types.ErrInternalError:
+			slog.ErrorContext(ctx, "Encountered a compose error", "code", composeErr.Code, "status", composeErr.StatusCode, "details", composeErr.Details)
+		case types.ErrInvalidRequest, types.ErrForbidden, types.ErrAuthRevoked:
+			slog.WarnContext(ctx, "Encountered a compose error", "code", composeErr.Code, "status", composeErr.StatusCode, "details", composeErr.Details)
 		}
 	} else {
-		log.Printf("Encountered an error: %+v", err.Error())
+		slog.ErrorContext(ctx, "Encountered an error", "error", err)
 	}
 }
@@ -0,0 +1,639 @@
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/idempotency"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/logging"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/quota"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/ratelimit"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/revocation"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/utils"
+)
+
+type fakeClient struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (c *fakeClient) Call(_ context.Context, _, _ string) (types.Haiku, error) {
+	n := c.calls.Add(1)
+	if c.err != nil {
+		return types.Haiku{}, c.err
+	}
+	return types.Haiku{
+		Title:       "EXAMPLE_TITLE",
+		Haiku:       "EXAMPLE_HAIKU " + string(rune('0'+n)),
+		Description: "EXAMPLE_DESCRIPTION",
+		AltText:     "EXAMPLE_ALT_TEXT",
+	}, nil
+}
+
+func TestComposeHaikuIdempotency(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	validToken := token(t, keyPair, time.Minute)
+	withVerifier := WithVerifier(verifier(t, keyPair))
+
+	body := `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`
+	otherBody := `{"language":"German","base64Image":"EXAMPLE_BASE64_IMAGE"}`
+
+	cases := []struct {
+		name          string
+		clientErr     error
+		requests      []string
+		keys          []string
+		wantCalls     int32
+		wantStatus    []int
+		wantReplayed  []bool
+		wantSameBody  bool
+		wantErrorCode types.ErrorCode
+	}{
+		{
+			name:         "no key calls the client every time",
+			requests:     []string{body, body},
+			keys:         []string{"", ""},
+			wantCalls:    2,
+			wantStatus:   []int{http.StatusOK, http.StatusOK},
+			wantReplayed: []bool{false, false},
+		},
+		{
+			name:         "repeated key replays the response",
+			requests:     []string{body, body},
+			keys:         []string{"EXAMPLE_KEY", "EXAMPLE_KEY"},
+			wantCalls:    1,
+			wantStatus:   []int{http.StatusOK, http.StatusOK},
+			wantReplayed: []bool{false, true},
+			wantSameBody: true,
+		},
+		{
+			name:          "repeated key with different body is rejected",
+			requests:      []string{body, otherBody},
+			keys:          []string{"EXAMPLE_KEY", "EXAMPLE_KEY"},
+			wantCalls:     1,
+			wantStatus:    []int{http.StatusOK, http.StatusUnprocessableEntity},
+			wantReplayed:  []bool{false, false},
+			wantErrorCode: types.ErrIdempotencyKeyReused,
+		},
+		{
+			name:         "server errors are not stored",
+			clientErr:    utils.NewInternalErr("%s", "EXAMPLE_ERROR"),
+			requests:     []string{body, body},
+			keys:         []string{"EXAMPLE_KEY", "EXAMPLE_KEY"},
+			wantCalls:    2,
+			wantStatus:   []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			wantReplayed: []bool{false, false},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &fakeClient{err: c.clientErr}
+			handler := ComposeHaiku(client, withVerifier, WithIdempotencyStore(idempotency.NewMemoryStore(), time.Hour))
+
+			var bodies []string
+			for i, reqBody := range c.requests {
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(reqBody))
+				req.Header.Set("Authorization", "Bearer "+validToken)
+				if c.keys[i] != "" {
+					req.Header.Set(idempotency.Header, c.keys[i])
+				}
+				rec := httptest.NewRecorder()
+
+				handler(rec, req)
+
+				if rec.Code != c.wantStatus[i] {
+					t.Errorf("Request %d: expected status %d, got %d", i, c.wantStatus[i], rec.Code)
+				}
+				if replayed := rec.Header().Get(idempotency.ReplayedHeader) == "true"; replayed != c.wantReplayed[i] {
+					t.Errorf("Request %d: expected replayed to be %v, got %v", i, c.wantReplayed[i], replayed)
+				}
+				bodies = append(bodies, rec.Body.String())
+			}
+
+			if calls := client.calls.Load(); calls != c.wantCalls {
+				t.Errorf("Expected %d client calls, got %d", c.wantCalls, calls)
+			}
+
+			if c.wantSameBody && bodies[0] != bodies[1] {
+				t.Errorf("Expected replayed body %q, got %q", bodies[0], bodies[1])
+			}
+
+			if c.wantErrorCode != "" {
+				var errorResponse types.ErrorResponse
+				if err := json.Unmarshal([]byte(bodies[len(bodies)-1]), &errorResponse); err != nil {
+					t.Fatalf("Failed to decode error response: %v", err)
+				}
+				if errorResponse.Code != c.wantErrorCode {
+					t.Errorf("Expected error code %s, got %s", c.wantErrorCode, errorResponse.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestComposeHaikuRateLimit(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	validToken := token(t, keyPair, time.Minute)
+	withVerifier := WithVerifier(verifier(t, keyPair))
+
+	client := &fakeClient{}
+	handler := ComposeHaiku(client, withVerifier, WithRateLimiter(ratelimit.NewTokenBucket(ratelimit.Config{Burst: 1, Refill: time.Minute})))
+
+	var rec *httptest.ResponseRecorder
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`))
+		req.Header.Set("Authorization", "Bearer "+validToken)
+		rec = httptest.NewRecorder()
+
+		handler(rec, req)
+
+		if rec.Code != want {
+			t.Fatalf("Request %d: expected status %d, got %d", i, want, rec.Code)
+		}
+	}
+
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Expected Retry-After of 60 seconds, got %q", got)
+	}
+
+	var errorResponse types.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errorResponse); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if errorResponse.Code != types.ErrRateLimited {
+		t.Errorf("Expected error code %s, got %s", types.ErrRateLimited, errorResponse.Code)
+	}
+
+	if calls := client.calls.Load(); calls != 1 {
+		t.Errorf("Expected 1 client call, got %d", calls)
+	}
+}
+
+func TestComposeHaikuQuota(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	withVerifier := WithVerifier(verifier(t, keyPair))
+
+	freeToken := token(t, keyPair, time.Minute)
+	premiumToken, err := jwt.JWTForTesting(jwt.JWTConfig{
+		KeyPair: keyPair,
+		Sub:     "img2haiku-backend-premium",
+		Aud:     "img2haiku-backend",
+		Exp:     time.Minute,
+		Claims:  map[string]any{"plan": "premium"},
+	})
+	if err != nil {
+		t.Fatalf("failed to generate JWT: %v", err)
+	}
+
+	plans := map[string]quota.Plan{
+		"free":    {Daily: 1},
+		"premium": {Daily: 2},
+	}
+	client := &fakeClient{}
+	handler := ComposeHaiku(client, withVerifier, WithQuota(quota.New(quota.NewMemoryStore(), plans)))
+
+	steps := []struct {
+		name          string
+		token         string
+		wantStatus    int
+		wantRemaining string
+		wantErrorCode types.ErrorCode
+	}{
+		{name: "free plan first haiku", token: freeToken, wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "free plan quota exceeded", token: freeToken, wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantErrorCode: types.ErrQuotaExceeded},
+		{name: "premium plan first haiku", token: premiumToken, wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "premium plan second haiku", token: premiumToken, wantStatus: http.StatusOK, wantRemaining: "0"},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`))
+		req.Header.Set("Authorization", "Bearer "+step.token)
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		if rec.Code != step.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", step.name, step.wantStatus, rec.Code)
+		}
+		if got := rec.Header().Get(quota.RemainingHeader); got != step.wantRemaining {
+			t.Errorf("%s: expected %s header %q, got %q", step.name, quota.RemainingHeader, step.wantRemaining, got)
+		}
+		if rec.Header().Get(quota.ResetHeader) == "" {
+			t.Errorf("%s: expected %s header to be set", step.name, quota.ResetHeader)
+		}
+		if step.wantErrorCode != "" {
+			var errorResponse types.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &errorResponse); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if errorResponse.Code != step.wantErrorCode {
+				t.Errorf("%s: expected error code %s, got %s", step.name, step.wantErrorCode, errorResponse.Code)
+			}
+		}
+	}
+
+	if calls := client.calls.Load(); calls != 3 {
+		t.Errorf("Expected 3 client calls, got %d", calls)
+	}
+}
+
+// cachedClient answers every call from the cache.
+type cachedClient struct{}
+
+func (cachedClient) Call(_ context.Context, _, _ string) (types.Haiku, error) {
+	return types.Haiku{Haiku: "EXAMPLE_HAIKU", Cache: types.CacheHit}, nil
+}
+
+func TestComposeHaikuQuotaNotCounted(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	withVerifier := WithVerifier(verifier(t, keyPair))
+	withQuota := WithQuota(quota.New(quota.NewMemoryStore(), map[string]quota.Plan{"free": {Daily: 1}}))
+
+	steps := []struct {
+		name       string
+		client     types.Client
+		wantStatus int
+	}{
+		{name: "failed call", client: &fakeClient{err: utils.NewInternalErr("%s", "EXAMPLE_ERROR")}, wantStatus: http.StatusInternalServerError},
+		{name: "cache hit", client: cachedClient{}, wantStatus: http.StatusOK},
+		{name: "composed haiku", client: &fakeClient{}, wantStatus: http.StatusOK},
+		{name: "quota exceeded", client: &fakeClient{}, wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`))
+		req.Header.Set("Authorization", "Bearer "+token(t, keyPair, time.Minute))
+		rec := httptest.NewRecorder()
+
+		ComposeHaiku(step.client, withVerifier, withQuota)(rec, req)
+
+		if rec.Code != step.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", step.name, step.wantStatus, rec.Code)
+		}
+	}
+}
+
+func TestComposeHaikuRequestID(t *testing.T) {
+	handler := logging.Middleware(http.HandlerFunc(ComposeHaiku(&fakeClient{})))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	req.Header.Set(logging.RequestIDHeader, "EXAMPLE_REQUEST_ID")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(logging.RequestIDHeader); got != "EXAMPLE_REQUEST_ID" {
+		t.Errorf("Expected request ID header EXAMPLE_REQUEST_ID, got %q", got)
+	}
+
+	var errorResponse types.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errorResponse); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if errorResponse.RequestID != "EXAMPLE_REQUEST_ID" {
+		t.Errorf("Expected request ID EXAMPLE_REQUEST_ID in the error response, got %q", errorResponse.RequestID)
+	}
+}
+
+func TestComposeHaikuSpans(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	validToken := token(t, keyPair, time.Minute)
+	withVerifier := WithVerifier(verifier(t, keyPair))
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`))
+	req.Header.Set("Authorization", "Bearer "+validToken)
+	rec := httptest.NewRecorder()
+
+	ComposeHaiku(&fakeClient{}, withVerifier)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	want := []string{"jwt.validate", "compose.decode", "compose.prompt"}
+	if !slices.Equal(names, want) {
+		t.Errorf("Expected spans %v, got %v", want, names)
+	}
+}
+
+// claimsClient records the caller's claims that reach the client.
+type claimsClient struct {
+	fakeClient
+	claims jwt.Claims
+	ok     bool
+}
+
+func (c *claimsClient) Call(ctx context.Context, prompt, base64Image string) (types.Haiku, error) {
+	c.claims, c.ok = jwt.ClaimsFromContext(ctx)
+	return c.fakeClient.Call(ctx, prompt, base64Image)
+}
+
+func TestComposeHaikuClaimsInContext(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	validToken, err := jwt.JWTForTesting(jwt.JWTConfig{
+		KeyPair: keyPair,
+		Sub:     "EXAMPLE_SUBJECT",
+		Aud:     jwt.DefaultAudience,
+		Exp:     time.Minute,
+		Claims:  map[string]any{"plan": "premium", "scope": "haiku:compose", "device": "EXAMPLE_DEVICE"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`))
+	req.Header.Set("Authorization", "Bearer "+validToken)
+	rec := httptest.NewRecorder()
+	client := &claimsClient{}
+
+	ComposeHaiku(client, WithVerifier(verifier(t, keyPair)))(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if !client.ok {
+		t.Fatalf("Expected the claims in the client's context")
+	}
+	if client.claims.Subject != "EXAMPLE_SUBJECT" || client.claims.Plan != "premium" {
+		t.Errorf("Expected subject EXAMPLE_SUBJECT and plan premium, got %+v", client.claims)
+	}
+	if !slices.Equal(client.claims.Scopes, []string{"haiku:compose"}) {
+		t.Errorf("Expected scopes [haiku:compose], got %v", client.claims.Scopes)
+	}
+	if got := client.claims.Custom["device"]; got != "EXAMPLE_DEVICE" {
+		t.Errorf("Expected custom claim device EXAMPLE_DEVICE, got %v", got)
+	}
+}
+
+func TestComposeHaikuScopes(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	handler := ComposeHaiku(&fakeClient{}, WithVerifier(verifier(t, keyPair)), WithScopeCheck())
+
+	cases := []struct {
+		name       string
+		scope      string
+		body       string
+		wantStatus int
+	}{
+		{name: "no scopes", body: `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`, wantStatus: http.StatusForbidden},
+		{name: "compose", scope: "haiku:compose", body: `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`, wantStatus: http.StatusOK},
+		{name: "premium scopes only", scope: "haiku:variants haiku:hd", body: `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`, wantStatus: http.StatusForbidden},
+		{name: "variant without scope", scope: "haiku:compose", body: `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE","onDuplicate":"vary"}`, wantStatus: http.StatusForbidden},
+		{name: "variant", scope: "haiku:compose haiku:variants", body: `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE","onDuplicate":"vary"}`, wantStatus: http.StatusOK},
+		{name: "high detail without scope", scope: "haiku:compose haiku:variants", body: `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE","detail":"high"}`, wantStatus: http.StatusForbidden},
+		{name: "high detail", scope: "haiku:compose haiku:hd", body: `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE","detail":"high"}`, wantStatus: http.StatusOK},
+		{name: "low detail", scope: "haiku:compose", body: `{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE","detail":"low"}`, wantStatus: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			token, err := jwt.JWTForTesting(jwt.JWTConfig{
+				KeyPair: keyPair,
+				Sub:     "EXAMPLE_SUBJECT",
+				Aud:     jwt.DefaultAudience,
+				Exp:     time.Minute,
+				Claims:  map[string]any{"scope": c.scope},
+			})
+			if err != nil {
+				t.Fatalf("Failed to generate JWT: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+
+			handler(rec, req)
+
+			if rec.Code != c.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", c.wantStatus, rec.Code, rec.Body.String())
+			}
+			if c.wantStatus == http.StatusForbidden {
+				var errorResponse types.ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&errorResponse); err != nil {
+					t.Fatalf("Failed to decode error response: %v", err)
+				}
+				if errorResponse.Code != types.ErrForbidden {
+					t.Errorf("Expected error code %s, got %s", types.ErrForbidden, errorResponse.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestComposeHaikuRevocation(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	store := revocation.NewMemoryStore()
+	store.Revoke(context.Background(), "EXAMPLE_REVOKED_ID", time.Now().Add(time.Hour))
+	handler := ComposeHaiku(&fakeClient{}, WithVerifier(verifier(t, keyPair)), WithRevocation(store, time.Minute))
+
+	token := func(id string, exp time.Duration) string {
+		token, err := jwt.JWTForTesting(jwt.JWTConfig{
+			KeyPair: keyPair,
+			Sub:     "EXAMPLE_SUBJECT",
+			Aud:     jwt.DefaultAudience,
+			Exp:     exp,
+			Claims:  map[string]any{"jti": id},
+		})
+		if err != nil {
+			t.Fatalf("Failed to generate JWT: %v", err)
+		}
+		return token
+	}
+	longLived := token("EXAMPLE_ID", jwt.DefaultTTL)
+	oneTime := token("EXAMPLE_ONE_TIME_ID", time.Minute)
+
+	steps := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "revoked token", token: token("EXAMPLE_REVOKED_ID", jwt.DefaultTTL), wantStatus: http.StatusUnauthorized},
+		{name: "revoked one-time token", token: token("EXAMPLE_REVOKED_ID", time.Minute), wantStatus: http.StatusUnauthorized},
+		{name: "long-lived token", token: longLived, wantStatus: http.StatusOK},
+		{name: "long-lived token again", token: longLived, wantStatus: http.StatusOK},
+		{name: "one-time token", token: oneTime, wantStatus: http.StatusOK},
+		{name: "replayed one-time token", token: oneTime, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`))
+		req.Header.Set("Authorization", "Bearer "+step.token)
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		if rec.Code != step.wantStatus {
+			t.Fatalf("%s: expected status %d, got %d: %s", step.name, step.wantStatus, rec.Code, rec.Body.String())
+		}
+		if step.wantStatus == http.StatusUnauthorized {
+			var errorResponse types.ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&errorResponse); err != nil {
+				t.Fatalf("%s: failed to decode error response: %v", step.name, err)
+			}
+			if errorResponse.Code != types.ErrAuthRevoked {
+				t.Errorf("%s: expected error code %s, got %s", step.name, types.ErrAuthRevoked, errorResponse.Code)
+			}
+		}
+	}
+}
+
+func TestComposeHaikuOneTimeToken(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	withVerifier := WithVerifier(verifier(t, keyPair))
+	revocations := revocation.NewMemoryStore()
+	withRevocation := WithRevocation(revocations, time.Minute)
+	withIdempotency := WithIdempotencyStore(idempotency.NewMemoryStore(), idempotency.DefaultTTL)
+
+	token := func(id string) string {
+		token, err := jwt.JWTForTesting(jwt.JWTConfig{
+			KeyPair: keyPair,
+			Sub:     "EXAMPLE_SUBJECT",
+			Aud:     jwt.DefaultAudience,
+			Exp:     time.Minute,
+			Claims:  map[string]any{"jti": id},
+		})
+		if err != nil {
+			t.Fatalf("Failed to generate JWT: %v", err)
+		}
+		return token
+	}
+	retried := token("EXAMPLE_ID")
+	idempotent := token("EXAMPLE_IDEMPOTENT_ID")
+
+	steps := []struct {
+		name           string
+		token          string
+		idempotencyKey string
+		revoke         string
+		client         types.Client
+		wantStatus     int
+	}{
+		{name: "failed call", token: retried, client: &fakeClient{err: utils.NewInternalErr("%s", "EXAMPLE_ERROR")}, wantStatus: http.StatusInternalServerError},
+		{name: "retry after a failed call", token: retried, client: &fakeClient{}, wantStatus: http.StatusOK},
+		{name: "replay", token: retried, client: &fakeClient{}, wantStatus: http.StatusUnauthorized},
+		{name: "idempotent request", token: idempotent, idempotencyKey: "EXAMPLE_KEY", client: &fakeClient{}, wantStatus: http.StatusOK},
+		{name: "idempotent retry", token: idempotent, idempotencyKey: "EXAMPLE_KEY", client: &fakeClient{}, wantStatus: http.StatusOK},
+		{name: "replay with another idempotency key", token: idempotent, idempotencyKey: "EXAMPLE_OTHER_KEY", client: &fakeClient{}, wantStatus: http.StatusUnauthorized},
+		{name: "idempotent retry after revocation", token: idempotent, idempotencyKey: "EXAMPLE_KEY", revoke: "EXAMPLE_IDEMPOTENT_ID", client: &fakeClient{}, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		if step.revoke != "" {
+			revocations.Revoke(context.Background(), step.revoke, time.Now().Add(time.Minute))
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`))
+		req.Header.Set("Authorization", "Bearer "+step.token)
+		if step.idempotencyKey != "" {
+			req.Header.Set(idempotency.Header, step.idempotencyKey)
+		}
+		rec := httptest.NewRecorder()
+
+		ComposeHaiku(step.client, withVerifier, withRevocation, withIdempotency)(rec, req)
+
+		if rec.Code != step.wantStatus {
+			t.Fatalf("%s: expected status %d, got %d: %s", step.name, step.wantStatus, rec.Code, rec.Body.String())
+		}
+		if step.wantStatus == http.StatusUnauthorized {
+			var errorResponse types.ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&errorResponse); err != nil {
+				t.Fatalf("%s: failed to decode error response: %v", step.name, err)
+			}
+			if errorResponse.Code != types.ErrAuthRevoked {
+				t.Errorf("%s: expected error code %s, got %s", step.name, types.ErrAuthRevoked, errorResponse.Code)
+			}
+		}
+	}
+}
+
+func TestComposeHaikuConcurrentOneTimeToken(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	token, err := jwt.JWTForTesting(jwt.JWTConfig{
+		KeyPair: keyPair,
+		Sub:     "EXAMPLE_SUBJECT",
+		Aud:     jwt.DefaultAudience,
+		Exp:     time.Minute,
+		Claims:  map[string]any{"jti": "EXAMPLE_ID"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	handler := ComposeHaiku(&fakeClient{}, WithVerifier(verifier(t, keyPair)), WithRevocation(revocation.NewMemoryStore(), time.Minute))
+
+	var served atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"language":"English","base64Image":"EXAMPLE_BASE64_IMAGE"}`))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+
+			handler(rec, req)
+
+			if rec.Code == http.StatusOK {
+				served.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := served.Load(); got != 1 {
+		t.Errorf("Expected exactly 1 served request, got %d", got)
+	}
+}
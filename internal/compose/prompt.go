@@ -5,9 +5,16 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/kigo"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
 	"github.com/rd-martin-zoeller/img2haiku-backend/internal/utils"
 )
 
+// promptVersion identifies the prompt templates in cache keys. Bump it
+// whenever the templates change, so that haikus composed with an older prompt
+// are no longer served from the cache.
+const promptVersion = "1"
+
 const promptTemplateWithoutTags = `
 First: Check if the image is appropriate. If it violates any policy, ignore the rest of this prompt, and instead, return:
 {
@@ -17,11 +24,16 @@ First: Check if the image is appropriate. If it violates any policy, ignore the
 Otherwise, proceed as follows:
 
 1. The output of this task should really impress the user by how well it captures the essence of the image. Here are some guidelines to help you:
+{{- if .ToneGuidance}}
+	- The user has asked for a specific tone: {{.ToneGuidance}}
+	- Keep this tone in both the description and the haiku, even if the subject of the image suggests a different mood.
+{{- else}}
 	- If the image has a funny or silly subject, be funny and silly.
 	- If the image has a serious or dramatic subject, use a significantly more serious tone.
 	- If you feel like the image is a work of art, be poetic and artistic.
 	- If you feel like the image captures an important memory, be heartfelt and emotional.
 	- And so on.
+{{- end}}
 2. Look at the image from a human’s perspective. Infer what makes this image interesting to the user by asking yourself the following questions: What is the subject of the image? What is happening in the image? What is the mood or emotion conveyed by the image? What are the colors, shapes, and textures present in the image?
 3. Using the answers to the above questions, describe the image in one or two sentences. Use the following language: {{.Language}}. Keep it concise, without leaving out any important details. Remember your description.
 4. If the image’s content is unclear, focus on a single visible element (e.g., color, light, or shapes) and the feeling it evokes.
@@ -32,13 +44,21 @@ Otherwise, proceed as follows:
 	- Make it powerful and evocative
 	- Don't be abstract or vague
 	- Don't be afraid to use strong imagery or metaphors to convey the essence of the image, without exaggerating or making it absurd
-5. Return the final answer in valid JSON with the following structure:
+{{- if .Kigo}}
+	- Include exactly one kigo (a traditional seasonal word) for {{.Season}}. If one of the following fits the image, use it{{if .KigoTranslated}}, translated into {{.Language}}{{end}}: {{.KigoWords}}. Otherwise, choose another kigo for {{.Season}} that fits the image.
+{{- end}}
+6. Give the haiku a short title of at most five words in {{.Language}}.
+7. Write an alt text for blind and visually impaired users who rely on a screen reader. Unlike your description, it must be objective and literal: state what is visible (subjects, actions, setting, notable colors and any legible text) in one or two plain sentences in {{.Language}}, without interpretation, metaphors or poetic language. Do not start with "Image of" or "Picture of".
+8. Return the final answer in valid JSON with the following structure:
 {
+	"title": "<the title of the haiku in {{.Language}}>",
 	"description": "<one-sentence description of the image in {{.Language}}>",
-	"haiku": "<the three-line poem in {{.Language}}>"
+	"altText": "<the objective alt text in {{.Language}}>",
+	"haiku": "<the three-line poem in {{.Language}}>"{{if .Kigo}},
+	"kigo": "<the kigo used in the haiku, exactly as it appears in the poem>"{{end}}
 }
-6. Do not wrap the final JSON answer in markdown or any other formatting.
-7. Do not include any explanations, disclaimers, or additional keys beyond "description" and "haiku" in the JSON output.
+9. Do not wrap the final JSON answer in markdown or any other formatting.
+10. Do not include any explanations, disclaimers, or additional keys beyond {{.AnswerKeys}} in the JSON output.
 `
 
 const promptTemplateWithTags = `
@@ -50,6 +70,7 @@ First: Check if the image is appropriate. If it violates any policy, ignore the
 Otherwise, proceed as follows:
 The user has provided the following tags that they say are relevant to the image: {{.TagsString}}. Use these tags to help you understand the image better and to generate the output.
 1. The output of this task should really impress the user by how well it captures the essence of the image in accordance to the tags they provided.
+{{- if .ToneGuidance}} The user has asked for a specific tone: {{.ToneGuidance}} Keep this tone in both the description and the haiku.{{end}}
 2. Look at the image from a human’s perspective. Infer what makes this image interesting to the user by asking yourself the following questions: What is the subject of the image? What is happening in the image? How do the provided tags fit the image? What are the colors, shapes, and textures present in the image?
 3. Using the answers to the above questions, describe the image in one or two sentences. Use the following language: {{.Language}}. Keep it concise, without leaving out any important details. Remember your description.
 4. If the image’s content is unclear, focus on a single visible element (e.g., color, light, or shapes) and the feeling it evokes.
@@ -60,27 +81,60 @@ The user has provided the following tags that they say are relevant to the image
 	- Make it powerful and evocative
 	- Don't be abstract or vague
 	- Don't be afraid to use strong imagery or metaphors to convey the essence of the image, without exaggerating or making it absurd
-5. Return the final answer in valid JSON with the following structure:
+{{- if .Kigo}}
+	- Include exactly one kigo (a traditional seasonal word) for {{.Season}}. If one of the following fits the image, use it{{if .KigoTranslated}}, translated into {{.Language}}{{end}}: {{.KigoWords}}. Otherwise, choose another kigo for {{.Season}} that fits the image.
+{{- end}}
+6. Give the haiku a short title of at most five words in {{.Language}}.
+7. Write an alt text for blind and visually impaired users who rely on a screen reader. Unlike your description, it must be objective and literal: state what is visible (subjects, actions, setting, notable colors and any legible text) in one or two plain sentences in {{.Language}}, without interpretation, metaphors or poetic language. Do not start with "Image of" or "Picture of".
+8. Return the final answer in valid JSON with the following structure:
 {
+	"title": "<the title of the haiku in {{.Language}}>",
 	"description": "<one-sentence description of the image in {{.Language}}>",
-	"haiku": "<the three-line poem in {{.Language}}>"
+	"altText": "<the objective alt text in {{.Language}}>",
+	"haiku": "<the three-line poem in {{.Language}}>"{{if .Kigo}},
+	"kigo": "<the kigo used in the haiku, exactly as it appears in the poem>"{{end}}
 }
-6. Do not wrap the final JSON answer in markdown or any other formatting.
-7. Do not include any explanations, disclaimers, or additional keys beyond "description" and "haiku" in the JSON output.
+9. Do not wrap the final JSON answer in markdown or any other formatting.
+10. Do not include any explanations, disclaimers, or additional keys beyond {{.AnswerKeys}} in the JSON output.
 `
 
-func makePrompt(language string, tags []string) (string, error) {
+var toneGuidance = map[types.Tone]string{
+	types.TonePlayful:     "playful. Be light-hearted, witty and a little silly.",
+	types.ToneSolemn:      "solemn. Be serious, dignified and contemplative.",
+	types.ToneRomantic:    "romantic. Be tender, warm and affectionate.",
+	types.ToneMelancholic: "melancholic. Be wistful and quietly sad, dwelling on transience and loss.",
+	types.ToneMinimalist:  "minimalist. Use as few and as simple words as possible, without any ornament.",
+}
+
+func makePrompt(req types.ComposeRequest) (string, error) {
 	var prompt string
 
 	data := struct {
-		Language   string
-		TagsString string
+		Language       string
+		TagsString     string
+		ToneGuidance   string
+		Kigo           bool
+		Season         types.Season
+		KigoWords      string
+		KigoTranslated bool
+		AnswerKeys     string
 	}{
-		Language:   language,
-		TagsString: makeTagsString(tags),
+		Language:     req.Language,
+		TagsString:   makeTagsString(req.Tags),
+		ToneGuidance: toneGuidance[req.Tone],
+		Kigo:         req.Kigo,
+		Season:       req.Season,
+		AnswerKeys:   `"title", "description", "altText" and "haiku"`,
+	}
+
+	if req.Kigo {
+		words, translated := kigo.Words(req.Language, req.Season)
+		data.KigoWords = strings.Join(words, ", ")
+		data.KigoTranslated = translated
+		data.AnswerKeys = `"title", "description", "altText", "haiku" and "kigo"`
 	}
 
-	promptTemplate := pickTemplate(tags)
+	promptTemplate := pickTemplate(req.Tags)
 
 	template, err := template.New("prompt").Parse(promptTemplate)
 	if err != nil {
@@ -3,10 +3,12 @@ package compose
 import (
 	"strings"
 	"testing"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
 )
 
 func TestMakePromp(t *testing.T) {
-	prompt, err := makePrompt("English", []string{})
+	prompt, err := makePrompt(types.ComposeRequest{Language: "English", Tags: []string{}, Tone: types.ToneAuto})
 
 	if len(prompt) == 0 {
 		t.Errorf("Expected prompt to be non-empty, got: %s", prompt)
@@ -16,12 +18,122 @@ func TestMakePromp(t *testing.T) {
 		t.Errorf("Expected no error, got: %v", err)
 	}
 
-	const expectedLangCount = 5
+	const expectedLangCount = 9
 	if langCount := strings.Count(prompt, "English"); langCount != expectedLangCount {
 		t.Errorf("Expected prompt to contain 'English' %v times, got %v times instead", expectedLangCount, langCount)
 	}
 }
 
+func TestMakePromptTone(t *testing.T) {
+	cases := []struct {
+		name         string
+		tags         []string
+		tone         types.Tone
+		wantContains string
+		wantMissing  string
+	}{
+		{
+			name:         "auto tone keeps generic guidance",
+			tone:         types.ToneAuto,
+			wantContains: "If the image has a funny or silly subject, be funny and silly.",
+			wantMissing:  "The user has asked for a specific tone",
+		},
+		{
+			name:         "explicit tone replaces generic guidance",
+			tone:         types.ToneMelancholic,
+			wantContains: "The user has asked for a specific tone: melancholic.",
+			wantMissing:  "If the image has a funny or silly subject, be funny and silly.",
+		},
+		{
+			name:         "explicit tone with tags",
+			tags:         []string{"Beach"},
+			tone:         types.TonePlayful,
+			wantContains: "The user has asked for a specific tone: playful.",
+		},
+		{
+			name:        "auto tone with tags",
+			tags:        []string{"Beach"},
+			tone:        types.ToneAuto,
+			wantMissing: "The user has asked for a specific tone",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			prompt, err := makePrompt(types.ComposeRequest{Language: "English", Tags: c.tags, Tone: c.tone})
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if c.wantContains != "" && !strings.Contains(prompt, c.wantContains) {
+				t.Errorf("Expected prompt to contain %q, got: %s", c.wantContains, prompt)
+			}
+
+			if c.wantMissing != "" && strings.Contains(prompt, c.wantMissing) {
+				t.Errorf("Expected prompt not to contain %q, got: %s", c.wantMissing, prompt)
+			}
+		})
+	}
+}
+
+func TestMakePromptKigo(t *testing.T) {
+	cases := []struct {
+		name         string
+		req          types.ComposeRequest
+		wantContains []string
+		wantMissing  []string
+	}{
+		{
+			name:        "no kigo requested",
+			req:         types.ComposeRequest{Language: "English", Tone: types.ToneAuto},
+			wantMissing: []string{"kigo"},
+		},
+		{
+			name: "kigo in supported language",
+			req:  types.ComposeRequest{Language: "Japanese", Tone: types.ToneAuto, Kigo: true, Season: types.SeasonAutumn},
+			wantContains: []string{
+				"Include exactly one kigo (a traditional seasonal word) for autumn. If one of the following fits the image, use it: 紅葉",
+				`"kigo": "<the kigo used in the haiku, exactly as it appears in the poem>"`,
+				`additional keys beyond "title", "description", "altText", "haiku" and "kigo"`,
+			},
+			wantMissing: []string{"translated into"},
+		},
+		{
+			name: "kigo in unsupported language is translated",
+			req:  types.ComposeRequest{Language: "German", Tags: []string{"Beach"}, Tone: types.ToneAuto, Kigo: true, Season: types.SeasonSummer},
+			wantContains: []string{
+				"use it, translated into German: cicada",
+				`additional keys beyond "title", "description", "altText", "haiku" and "kigo"`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			prompt, err := makePrompt(c.req)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			for _, want := range c.wantContains {
+				if !strings.Contains(prompt, want) {
+					t.Errorf("Expected prompt to contain %q, got: %s", want, prompt)
+				}
+			}
+
+			for _, missing := range c.wantMissing {
+				if strings.Contains(prompt, missing) {
+					t.Errorf("Expected prompt not to contain %q, got: %s", missing, prompt)
+				}
+			}
+		})
+	}
+}
+
 func TestMakeTagsString(t *testing.T) {
 	cases := []struct {
 		name string
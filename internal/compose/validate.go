@@ -1,27 +1,81 @@
 package compose
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/kigo"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/tracing"
 	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
 	"github.com/rd-martin-zoeller/img2haiku-backend/internal/utils"
 )
 
-func validateRequest(r *http.Request) (types.ComposeRequest, error) {
-	var req types.ComposeRequest
+// now is replaced in tests to derive a predictable season.
+var now = time.Now
+
+// MaxImageSize is the largest image OpenAI accepts, in bytes.
+const MaxImageSize = 20 << 20
 
-	if err := validateAuthHeader(r); err != nil {
-		return req, err
+// maxBodySize bounds the request body: the base64 encoding of the largest
+// image, plus room for the other fields.
+var maxBodySize = int64(base64.StdEncoding.EncodedLen(MaxImageSize) + 64<<10)
+
+// composeInput is a validated compose request along with the verified claims
+// of the caller and the raw body it was decoded from.
+type composeInput struct {
+	types.ComposeRequest
+	Claims jwt.Claims
+	Body   []byte
+}
+
+func validateRequest(w http.ResponseWriter, r *http.Request, verifier *jwt.Verifier) (composeInput, error) {
+	var input composeInput
+
+	_, span := tracing.Start(r.Context(), "jwt.validate")
+	claims, err := validateAuthHeader(r, verifier)
+	tracing.End(span, err)
+	if err != nil {
+		return input, err
 	}
+	input.Claims = claims
 
 	if r.Method != http.MethodPost {
-		return req, utils.NewErr(http.StatusMethodNotAllowed, types.ErrInternalError, "%s", "Method not allowed")
+		return input, utils.NewErr(http.StatusMethodNotAllowed, types.ErrInternalError, "%s", "Method not allowed")
+	}
+
+	_, span = tracing.Start(r.Context(), "compose.decode")
+	input.Body, input.ComposeRequest, err = decodeBody(w, r)
+	tracing.End(span, err)
+	return input, err
+}
+
+// decodeBody reads and validates the request body. Reading includes
+// receiving the image, so it can take long on slow connections.
+func decodeBody(w http.ResponseWriter, r *http.Request) ([]byte, types.ComposeRequest, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, types.ComposeRequest{}, utils.NewErr(http.StatusRequestEntityTooLarge, types.ErrInvalidRequest, "Request body must not be larger than %d bytes", maxBytesErr.Limit)
+	}
+	if err != nil {
+		return body, types.ComposeRequest{}, utils.NewInternalErr("%s", "Failed to read request body: "+err.Error())
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	req, err := validateBody(body)
+	return body, req, err
+}
+
+func validateBody(body []byte) (types.ComposeRequest, error) {
+	var req types.ComposeRequest
+
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&req); err != nil {
 		return req, utils.NewInternalErr("%s", "Failed to decode request body: "+err.Error())
 	}
 
@@ -33,28 +87,113 @@ func validateRequest(r *http.Request) (types.ComposeRequest, error) {
 		return req, utils.NewInternalErr("%s", "Base64 image is required")
 	}
 
+	if req.Tone == "" {
+		req.Tone = types.ToneAuto
+	}
+
+	if !req.Tone.Valid() {
+		return req, utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "Unsupported tone %q, must be one of: %s", req.Tone, joinValues(types.Tones))
+	}
+
+	if req.Hemisphere == "" {
+		req.Hemisphere = types.HemisphereNorthern
+	}
+
+	if !req.Hemisphere.Valid() {
+		return req, utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "Unsupported hemisphere %q, must be one of: %s", req.Hemisphere, joinValues([]types.Hemisphere{types.HemisphereNorthern, types.HemisphereSouthern}))
+	}
+
+	if req.Season != "" && !req.Season.Valid() {
+		return req, utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "Unsupported season %q, must be one of: %s", req.Season, joinValues(types.Seasons))
+	}
+
+	if req.OnDuplicate == "" {
+		req.OnDuplicate = types.DuplicateReuse
+	}
+
+	if !req.OnDuplicate.Valid() {
+		return req, utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "Unsupported onDuplicate %q, must be one of: %s", req.OnDuplicate, joinValues([]types.DuplicatePolicy{types.DuplicateReuse, types.DuplicateVary}))
+	}
+
+	if req.Detail != "" && !req.Detail.Valid() {
+		return req, utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "Unsupported detail %q, must be one of: %s", req.Detail, joinValues(types.ImageDetails))
+	}
+
+	if req.Kigo && req.Season == "" {
+		req.Season = kigo.SeasonAt(now(), req.Hemisphere)
+	}
+
 	return req, nil
 }
 
-func validateAuthHeader(r *http.Request) error {
+func joinValues[T ~string](values []T) string {
+	strs := make([]string, len(values))
+	for i, value := range values {
+		strs[i] = string(value)
+	}
+	return strings.Join(strs, ", ")
+}
+
+func validateAuthHeader(r *http.Request, verifier *jwt.Verifier) (jwt.Claims, error) {
+	if verifier == nil {
+		return jwt.Claims{}, utils.NewInternalErr("%s", "Token verification is not configured")
+	}
 	auth := r.Header.Get("Authorization")
 	if auth == "" {
-		return utils.NewErr(http.StatusUnauthorized, types.ErrInternalError, "%s", "Authorization header is required")
+		return jwt.Claims{}, utils.NewErr(http.StatusUnauthorized, types.ErrInternalError, "%s", "Authorization header is required")
 	}
 	if len(auth) < 7 || auth[:7] != "Bearer " {
-		return utils.NewErr(http.StatusUnauthorized, types.ErrInternalError, "%s", "Authorization header must start with 'Bearer '")
+		return jwt.Claims{}, utils.NewErr(http.StatusUnauthorized, types.ErrInternalError, "%s", "Authorization header must start with 'Bearer '")
 	}
 	token := auth[7:]
-	valid, err := jwt.Validate(token, os.Getenv("JWT_SECRET"))
+	claims, err := verifier.Verify(r.Context(), token)
 	if err != nil {
-		if err.Error() == "Token is expired" {
-			return utils.NewErr(http.StatusUnauthorized, types.ErrAuthExpired, "%s", "Token is expired")
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return claims, utils.NewErr(http.StatusUnauthorized, types.ErrAuthExpired, "%s", "Token is expired")
 		}
-		return utils.NewErr(http.StatusUnauthorized, types.ErrInternalError, "%s", "Invalid JWT token: "+err.Error())
+		return claims, utils.NewErr(http.StatusUnauthorized, tokenErrorCode(err), "%s", "Invalid JWT token: "+err.Error())
+	}
+
+	return claims, nil
+}
+
+// requiredScopes returns the scopes a token needs for req: one for the
+// endpoint and one for each premium option it asks for.
+func requiredScopes(req types.ComposeRequest) []string {
+	scopes := []string{jwt.ScopeCompose}
+	if req.OnDuplicate == types.DuplicateVary {
+		scopes = append(scopes, jwt.ScopeVariants)
 	}
-	if !valid {
-		return utils.NewErr(http.StatusUnauthorized, types.ErrInternalError, "%s", "Invalid JWT token")
+	if req.Detail == types.DetailHigh {
+		scopes = append(scopes, jwt.ScopeHD)
 	}
+	return scopes
+}
 
+// authorize rejects requests whose token lacks a required scope.
+func authorize(claims jwt.Claims, req types.ComposeRequest) error {
+	for _, scope := range requiredScopes(req) {
+		if !claims.HasScope(scope) {
+			return utils.NewErr(http.StatusForbidden, types.ErrForbidden, "Token lacks the %s scope", scope)
+		}
+	}
 	return nil
 }
+
+// tokenErrorCode tells the client which check the token failed.
+func tokenErrorCode(err error) types.ErrorCode {
+	switch {
+	case errors.Is(err, jwt.ErrTokenNotYetValid):
+		return types.ErrAuthNotYetValid
+	case errors.Is(err, jwt.ErrTokenTooOld):
+		return types.ErrAuthTooOld
+	case errors.Is(err, jwt.ErrInvalidIssuer):
+		return types.ErrAuthInvalidIssuer
+	case errors.Is(err, jwt.ErrInvalidAudience):
+		return types.ErrAuthInvalidAudience
+	case errors.Is(err, jwt.ErrMissingClaim):
+		return types.ErrAuthMissingClaim
+	default:
+		return types.ErrAuthInvalid
+	}
+}
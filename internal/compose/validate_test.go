@@ -19,7 +19,7 @@ func TestValidateRequest(t *testing.T) {
 	}
 	invalidToken := token(t, keyPair, -time.Minute)
 	validToken := token(t, keyPair, time.Minute)
-	t.Setenv("JWT_SECRET", keyPair.Public)
+	v := verifier(t, keyPair)
 	cases := []struct {
 		name           string
 		httpMethod     string
@@ -33,7 +33,7 @@ func TestValidateRequest(t *testing.T) {
 			name:           "token is missing",
 			httpMethod:     "GET",
 			wantStatusCode: 401,
-			wantErrorCode:  types.ErrInternalError,
+			wantErrorCode:  types.ErrAuthInvalid,
 			wantDetails:    "Invalid JWT token: token contains an invalid number of segments",
 		},
 		{
@@ -87,6 +87,51 @@ func TestValidateRequest(t *testing.T) {
 			wantErrorCode:  types.ErrInternalError,
 			wantDetails:    "Base64 image is required",
 		},
+		{
+			name:           "tone is unsupported",
+			httpMethod:     "POST",
+			body:           &types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE", Tone: "angry"},
+			token:          validToken,
+			wantStatusCode: 400,
+			wantErrorCode:  types.ErrInvalidRequest,
+			wantDetails:    `Unsupported tone "angry", must be one of: auto, playful, solemn, romantic, melancholic, minimalist`,
+		},
+		{
+			name:           "hemisphere is unsupported",
+			httpMethod:     "POST",
+			body:           &types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE", Hemisphere: "eastern"},
+			token:          validToken,
+			wantStatusCode: 400,
+			wantErrorCode:  types.ErrInvalidRequest,
+			wantDetails:    `Unsupported hemisphere "eastern", must be one of: northern, southern`,
+		},
+		{
+			name:           "duplicate policy is unsupported",
+			httpMethod:     "POST",
+			body:           &types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE", OnDuplicate: "ignore"},
+			token:          validToken,
+			wantStatusCode: 400,
+			wantErrorCode:  types.ErrInvalidRequest,
+			wantDetails:    `Unsupported onDuplicate "ignore", must be one of: reuse, vary`,
+		},
+		{
+			name:           "detail is unsupported",
+			httpMethod:     "POST",
+			body:           &types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE", Detail: "ultra"},
+			token:          validToken,
+			wantStatusCode: 400,
+			wantErrorCode:  types.ErrInvalidRequest,
+			wantDetails:    `Unsupported detail "ultra", must be one of: auto, low, high`,
+		},
+		{
+			name:           "season is unsupported",
+			httpMethod:     "POST",
+			body:           &types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE", Season: "monsoon"},
+			token:          validToken,
+			wantStatusCode: 400,
+			wantErrorCode:  types.ErrInvalidRequest,
+			wantDetails:    `Unsupported season "monsoon", must be one of: spring, summer, autumn, winter`,
+		},
 	}
 
 	for _, c := range cases {
@@ -99,7 +144,7 @@ func TestValidateRequest(t *testing.T) {
 			req := httptest.NewRequest(c.httpMethod, "/", strings.NewReader(string(bodyBytes)))
 			req.Header.Set("Authorization", "Bearer "+c.token)
 
-			_, err := validateRequest(req)
+			_, err := validateRequest(httptest.NewRecorder(), req, v)
 
 			if err == nil {
 				t.Fatalf("Expected error, got nil")
@@ -125,6 +170,82 @@ func TestValidateRequest(t *testing.T) {
 	}
 }
 
+func TestValidateRequestBodyTooLarge(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+
+	body := `{"language":"English","base64Image":"` + strings.Repeat("A", int(maxBodySize)) + `"}`
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token(t, keyPair, time.Minute))
+
+	_, err = validateRequest(httptest.NewRecorder(), req, verifier(t, keyPair))
+
+	var composeErr *types.ComposeError
+	if !errors.As(err, &composeErr) || composeErr.StatusCode != 413 {
+		t.Errorf("Expected status 413, got %v", err)
+	}
+}
+
+func TestValidateRequestSeason(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	validToken := token(t, keyPair, time.Minute)
+	v := verifier(t, keyPair)
+
+	originalNow := now
+	now = func() time.Time { return time.Date(2025, time.January, 15, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = originalNow })
+
+	cases := []struct {
+		name       string
+		body       types.ComposeRequest
+		wantSeason types.Season
+	}{
+		{
+			name:       "no kigo leaves season empty",
+			body:       types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE"},
+			wantSeason: "",
+		},
+		{
+			name:       "kigo derives season for northern hemisphere by default",
+			body:       types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE", Kigo: true},
+			wantSeason: types.SeasonWinter,
+		},
+		{
+			name:       "kigo derives season for southern hemisphere",
+			body:       types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE", Kigo: true, Hemisphere: types.HemisphereSouthern},
+			wantSeason: types.SeasonSummer,
+		},
+		{
+			name:       "explicit season wins over date",
+			body:       types.ComposeRequest{Language: "English", Base64Image: "EXAMPLE_BASE64_IMAGE", Kigo: true, Season: types.SeasonAutumn},
+			wantSeason: types.SeasonAutumn,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bodyBytes := requestJSONHelper(t, &c.body)
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(string(bodyBytes)))
+			req.Header.Set("Authorization", "Bearer "+validToken)
+
+			got, err := validateRequest(httptest.NewRecorder(), req, v)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if got.Season != c.wantSeason {
+				t.Errorf("Expected season %q, got %q", c.wantSeason, got.Season)
+			}
+		})
+	}
+}
+
 func requestJSONHelper(t *testing.T, body *types.ComposeRequest) []byte {
 	t.Helper()
 
@@ -140,6 +261,68 @@ func requestJSONHelper(t *testing.T, body *types.ComposeRequest) []byte {
 	return []byte{}
 }
 
+func TestValidateAuthHeaderErrorCodes(t *testing.T) {
+	keyPair, err := jwt.GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	v, err := jwt.NewVerifier(jwt.VerifierConfig{
+		PublicKey: keyPair.Public,
+		Issuers:   []string{"EXAMPLE_ISSUER"},
+		MaxAge:    time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	now := time.Now()
+	cases := []struct {
+		name     string
+		config   jwt.JWTConfig
+		wantCode types.ErrorCode
+	}{
+		{name: "valid", config: jwt.JWTConfig{Sub: "EXAMPLE_SUBJECT", Aud: jwt.DefaultAudience, Iss: "EXAMPLE_ISSUER", Exp: time.Minute}},
+		{name: "expired", config: jwt.JWTConfig{Sub: "EXAMPLE_SUBJECT", Aud: jwt.DefaultAudience, Iss: "EXAMPLE_ISSUER", Exp: -time.Minute}, wantCode: types.ErrAuthExpired},
+		{name: "other audience", config: jwt.JWTConfig{Sub: "EXAMPLE_SUBJECT", Aud: "EXAMPLE_AUDIENCE", Iss: "EXAMPLE_ISSUER", Exp: time.Minute}, wantCode: types.ErrAuthInvalidAudience},
+		{name: "other issuer", config: jwt.JWTConfig{Sub: "EXAMPLE_SUBJECT", Aud: jwt.DefaultAudience, Iss: "EXAMPLE_STAGING_ISSUER", Exp: time.Minute}, wantCode: types.ErrAuthInvalidIssuer},
+		{name: "missing subject", config: jwt.JWTConfig{Aud: jwt.DefaultAudience, Iss: "EXAMPLE_ISSUER", Exp: time.Minute}, wantCode: types.ErrAuthMissingClaim},
+		{name: "not yet valid", config: jwt.JWTConfig{Sub: "EXAMPLE_SUBJECT", Aud: jwt.DefaultAudience, Iss: "EXAMPLE_ISSUER", Exp: time.Hour, Claims: map[string]any{"nbf": now.Add(time.Minute).Unix()}}, wantCode: types.ErrAuthNotYetValid},
+		{name: "too old", config: jwt.JWTConfig{Sub: "EXAMPLE_SUBJECT", Aud: jwt.DefaultAudience, Iss: "EXAMPLE_ISSUER", Exp: time.Hour, Claims: map[string]any{"iat": now.Add(-2 * time.Hour).Unix()}}, wantCode: types.ErrAuthTooOld},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			c.config.KeyPair = keyPair
+			token, err := jwt.JWTForTesting(c.config)
+			if err != nil {
+				t.Fatalf("Failed to generate JWT: %v", err)
+			}
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			_, err = validateAuthHeader(req, v)
+			if c.wantCode == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			var composeErr *types.ComposeError
+			if !errors.As(err, &composeErr) {
+				t.Fatalf("Expected a compose error, got %v", err)
+			}
+			if composeErr.Code != c.wantCode {
+				t.Errorf("Expected error code %s, got %s", c.wantCode, composeErr.Code)
+			}
+			if composeErr.StatusCode != 401 {
+				t.Errorf("Expected status 401, got %d", composeErr.StatusCode)
+			}
+		})
+	}
+}
+
 func token(t *testing.T, keyPair jwt.KeyPair, exp time.Duration) string {
 	t.Helper()
 
@@ -155,3 +338,13 @@ func token(t *testing.T, keyPair jwt.KeyPair, exp time.Duration) string {
 	}
 	return token
 }
+
+func verifier(t *testing.T, keyPair jwt.KeyPair) *jwt.Verifier {
+	t.Helper()
+
+	verifier, err := jwt.NewVerifier(jwt.VerifierConfig{PublicKey: keyPair.Public})
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	return verifier
+}
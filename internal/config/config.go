@@ -0,0 +1,398 @@
+// Package config loads the service's configuration from defaults, an
+// optional YAML or JSON file, the environment and command-line flags, in
+// increasing order of precedence.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/budget"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/logging"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/openai"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/ratelimit"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/server"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/tracing"
+)
+
+const redacted = "[REDACTED]"
+
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+type Config struct {
+	OpenAI    OpenAI    `yaml:"openai"`
+	JWT       JWT       `yaml:"jwt"`
+	Store     Store     `yaml:"store"`
+	RateLimit RateLimit `yaml:"rateLimit"`
+	Budget    Budget    `yaml:"budget"`
+	Log       Log       `yaml:"log"`
+	Trace     Trace     `yaml:"trace"`
+	Server    Server    `yaml:"server"`
+	Admin     Admin     `yaml:"admin"`
+}
+
+type OpenAI struct {
+	APIKey      string        `yaml:"apiKey"`
+	APIURL      string        `yaml:"apiUrl"`
+	Model       string        `yaml:"model"`
+	MaxTokens   int           `yaml:"maxTokens"`
+	Temperature float64       `yaml:"temperature"`
+	Timeout     time.Duration `yaml:"timeout"`
+	// Prices add to or override openai.DefaultPrices.
+	Prices openai.PriceTable `yaml:"prices"`
+}
+
+type JWT struct {
+	// PublicKey is the PEM-encoded key that verifies tokens.
+	PublicKey string `yaml:"publicKey"`
+	// JWKSURL serves the keys that verify tokens instead of PublicKey, so
+	// that the auth server can rotate them.
+	JWKSURL string `yaml:"jwksUrl"`
+	// JWKSRefresh is how often the keys are fetched from JWKSURL.
+	JWKSRefresh time.Duration `yaml:"jwksRefresh"`
+	// Algorithms are the signing algorithms tokens may use.
+	Algorithms []string `yaml:"algorithms"`
+	// Audiences are the audiences tokens may be issued for.
+	Audiences []string `yaml:"audiences"`
+	// Issuers are the accepted token issuers; any issuer if empty.
+	Issuers []string `yaml:"issuers"`
+	// RequiredClaims must be present in every token.
+	RequiredClaims []string `yaml:"requiredClaims"`
+	// Leeway allows for clock skew when checking the time claims.
+	Leeway time.Duration `yaml:"leeway"`
+	// MaxAge rejects tokens issued longer ago; zero means no limit.
+	MaxAge time.Duration `yaml:"maxAge"`
+	// EnforceScopes requires the scopes for the endpoint and premium
+	// options in every token. It is off by default, since tokens issued
+	// before scopes existed have none.
+	EnforceScopes bool `yaml:"enforceScopes"`
+	// RevocationFile persists the IDs of revoked and used tokens of the
+	// memory backend; they are kept in memory if empty.
+	RevocationFile string `yaml:"revocationFile"`
+	// OneTimeTTL lets tokens that live at most this long be used only once;
+	// zero means any token may be reused.
+	OneTimeTTL time.Duration `yaml:"oneTimeTtl"`
+	// Subject is the subject of tokens issued for local testing.
+	Subject string `yaml:"subject"`
+}
+
+type Store struct {
+	// Backend is memory or redis.
+	Backend  string `yaml:"backend"`
+	RedisURL string `yaml:"redisUrl"`
+	// QuotaFile persists quota counters of the memory backend.
+	QuotaFile string `yaml:"quotaFile"`
+}
+
+type RateLimit struct {
+	Burst  int           `yaml:"burst"`
+	Refill time.Duration `yaml:"refill"`
+}
+
+type Budget struct {
+	// DailyUSD and MonthlyUSD cap the spend; zero means no cap.
+	DailyUSD      float64 `yaml:"dailyUsd"`
+	MonthlyUSD    float64 `yaml:"monthlyUsd"`
+	FallbackModel string  `yaml:"fallbackModel"`
+}
+
+type Log struct {
+	Format    logging.Format `yaml:"format"`
+	Level     string         `yaml:"level"`
+	ProjectID string         `yaml:"projectId"`
+}
+
+type Trace struct {
+	Exporter     tracing.Exporter `yaml:"exporter"`
+	OTLPEndpoint string           `yaml:"otlpEndpoint"`
+}
+
+// Server configures the standalone server; the Cloud Function ignores it.
+type Server struct {
+	Addr              string        `yaml:"addr"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout"`
+	TLSCertFile       string        `yaml:"tlsCertFile"`
+	TLSKeyFile        string        `yaml:"tlsKeyFile"`
+}
+
+// Admin configures the admin endpoints, which are disabled without a token.
+type Admin struct {
+	// Token authorizes requests to the admin endpoints as a bearer token.
+	Token string `yaml:"token"`
+	// MetricsToken authorizes scrapes of /metrics as a bearer token.
+	MetricsToken string `yaml:"metricsToken"`
+}
+
+// Default returns the configuration used for everything that is not set
+// explicitly.
+func Default() Config {
+	logFormat := logging.FormatJSON
+	// Cloud Run and Cloud Functions set K_SERVICE; log in their format there.
+	if os.Getenv("K_SERVICE") != "" {
+		logFormat = logging.FormatGCP
+	}
+
+	addr := server.DefaultConfig.Addr
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+
+	return Config{
+		OpenAI: OpenAI{
+			APIURL:      openai.DefaultAPIURL,
+			Model:       openai.DefaultModel,
+			MaxTokens:   openai.DefaultMaxTokens,
+			Temperature: openai.DefaultTemperature,
+			Timeout:     30 * time.Second,
+			Prices:      maps.Clone(openai.DefaultPrices),
+		},
+		JWT: JWT{
+			JWKSRefresh:    jwt.DefaultJWKSRefresh,
+			Algorithms:     slices.Clone(jwt.SupportedAlgorithms),
+			Audiences:      []string{jwt.DefaultAudience},
+			RequiredClaims: slices.Clone(jwt.DefaultRequiredClaims),
+			Subject:        jwt.DefaultSubject,
+		},
+		Store: Store{
+			Backend: StoreMemory,
+		},
+		RateLimit: RateLimit{
+			Burst:  ratelimit.DefaultConfig.Burst,
+			Refill: ratelimit.DefaultConfig.Refill,
+		},
+		Log: Log{
+			Format: logFormat,
+			Level:  "info",
+		},
+		Trace: Trace{
+			Exporter: tracing.ExporterNone,
+		},
+		Server: Server{
+			Addr:              addr,
+			ReadHeaderTimeout: server.DefaultConfig.ReadHeaderTimeout,
+			ReadTimeout:       server.DefaultConfig.ReadTimeout,
+			WriteTimeout:      server.DefaultConfig.WriteTimeout,
+			IdleTimeout:       server.DefaultConfig.IdleTimeout,
+			ShutdownTimeout:   server.DefaultConfig.ShutdownTimeout,
+		},
+	}
+}
+
+// Validate reports every invalid setting, named by its environment variable.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if u, err := url.Parse(c.OpenAI.APIURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("OPENAI_API_URL must be an absolute URL, got %q", c.OpenAI.APIURL))
+	}
+	check(c.OpenAI.Model != "", "OPENAI_MODEL must not be empty")
+	check(c.OpenAI.MaxTokens > 0, "OPENAI_MAX_TOKENS must be positive, got %d", c.OpenAI.MaxTokens)
+	check(c.OpenAI.Temperature >= 0 && c.OpenAI.Temperature <= 2, "OPENAI_TEMPERATURE must be between 0 and 2, got %v", c.OpenAI.Temperature)
+	check(c.OpenAI.Timeout > 0, "OPENAI_TIMEOUT must be positive, got %s", c.OpenAI.Timeout)
+	if c.JWT.JWKSURL != "" {
+		if u, err := url.Parse(c.JWT.JWKSURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("JWT_JWKS_URL must be an http or https URL, got %q", c.JWT.JWKSURL))
+		}
+	}
+	check(c.JWT.JWKSRefresh > 0, "JWT_JWKS_REFRESH must be positive, got %s", c.JWT.JWKSRefresh)
+	check(len(c.JWT.Algorithms) > 0, "JWT_ALGORITHMS must not be empty")
+	for _, alg := range c.JWT.Algorithms {
+		check(slices.Contains(jwt.SupportedAlgorithms, alg), "JWT_ALGORITHMS must only contain %s, got %q", strings.Join(jwt.SupportedAlgorithms, ", "), alg)
+	}
+	check(len(c.JWT.Audiences) > 0, "JWT_AUDIENCE must not be empty")
+	check(c.JWT.Leeway >= 0, "JWT_LEEWAY must not be negative, got %s", c.JWT.Leeway)
+	check(c.JWT.MaxAge >= 0, "JWT_MAX_AGE must not be negative, got %s", c.JWT.MaxAge)
+	check(c.JWT.OneTimeTTL >= 0, "JWT_ONE_TIME_TTL must not be negative, got %s", c.JWT.OneTimeTTL)
+
+	switch c.Store.Backend {
+	case StoreMemory:
+	case StoreRedis:
+		check(c.Store.RedisURL != "", "REDIS_URL is required for STORE_BACKEND redis")
+	default:
+		errs = append(errs, fmt.Errorf("STORE_BACKEND must be %s or %s, got %q", StoreMemory, StoreRedis, c.Store.Backend))
+	}
+
+	check(c.RateLimit.Burst > 0, "RATE_LIMIT_BURST must be positive, got %d", c.RateLimit.Burst)
+	check(c.RateLimit.Refill >= ratelimit.MinRefill, "RATE_LIMIT_REFILL must be at least %s, got %s", ratelimit.MinRefill, c.RateLimit.Refill)
+	check(c.Budget.DailyUSD >= 0, "BUDGET_DAILY_USD must not be negative, got %v", c.Budget.DailyUSD)
+	check(c.Budget.MonthlyUSD >= 0, "BUDGET_MONTHLY_USD must not be negative, got %v", c.Budget.MonthlyUSD)
+
+	if _, err := logging.ParseFormat(string(c.Log.Format)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT: %w", err))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+
+	switch c.Trace.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("TRACE_EXPORTER must be none, stdout or otlp, got %q", c.Trace.Exporter))
+	}
+
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+
+	return errors.Join(errs...)
+}
+
+// CheckSecrets reports missing or malformed secrets, with hints on how to
+// fix them. Unlike Validate, it is only run by the entry points, since
+// tests and tools may not need the secrets.
+func (c Config) CheckSecrets() error {
+	var errs []error
+
+	switch {
+	case c.OpenAI.APIKey == "":
+		errs = append(errs, errors.New("OPENAI_API_KEY is not set; create a key at https://platform.openai.com/api-keys and set OPENAI_API_KEY or openai.apiKey in the configuration file"))
+	case strings.ContainsFunc(c.OpenAI.APIKey, unicode.IsSpace):
+		errs = append(errs, errors.New("OPENAI_API_KEY contains whitespace; check it for a trailing newline or surrounding quotes"))
+	}
+
+	switch {
+	case c.JWT.JWKSURL != "":
+		// The keys are fetched when tokens arrive.
+	case c.JWT.PublicKey == "":
+		errs = append(errs, errors.New("JWT_SECRET is not set; set it to the PEM-encoded public key of the auth server that issues the tokens, or set JWT_JWKS_URL"))
+	default:
+		if err := jwt.CheckPublicKey(c.JWT.PublicKey); err != nil {
+			errs = append(errs, fmt.Errorf("JWT_SECRET is not a usable public key (%v); it must be a PEM block starting with -----BEGIN PUBLIC KEY----- with real line breaks, not \\n escapes", err))
+		}
+	}
+
+	if strings.ContainsFunc(c.Admin.Token, unicode.IsSpace) {
+		errs = append(errs, errors.New("ADMIN_TOKEN contains whitespace; check it for a trailing newline or surrounding quotes"))
+	}
+	if strings.ContainsFunc(c.Admin.MetricsToken, unicode.IsSpace) {
+		errs = append(errs, errors.New("METRICS_TOKEN contains whitespace; check it for a trailing newline or surrounding quotes"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// LogLevel returns the parsed Log.Level.
+func (c Config) LogLevel() slog.Level {
+	return logging.ParseLevel(c.Log.Level)
+}
+
+// RateLimitConfig returns the RateLimit section for the rate limiter.
+func (c Config) RateLimitConfig() ratelimit.Config {
+	return ratelimit.Config{Burst: c.RateLimit.Burst, Refill: c.RateLimit.Refill}
+}
+
+// BudgetConfig returns the Budget section for the budget controller.
+func (c Config) BudgetConfig() budget.Config {
+	return budget.Config{
+		DailyCapUSD:   c.Budget.DailyUSD,
+		MonthlyCapUSD: c.Budget.MonthlyUSD,
+		WarnAt:        budget.DefaultWarnAt,
+		FallbackModel: c.Budget.FallbackModel,
+	}
+}
+
+// ServerConfig returns the Server section for the standalone server.
+func (c Config) ServerConfig() server.Config {
+	return server.Config(c.Server)
+}
+
+// LogValue logs the configuration with secrets redacted.
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Group("openai",
+			slog.String("apiKey", secret(c.OpenAI.APIKey)),
+			slog.String("apiUrl", c.OpenAI.APIURL),
+			slog.String("model", c.OpenAI.Model),
+			slog.Int("maxTokens", c.OpenAI.MaxTokens),
+			slog.Float64("temperature", c.OpenAI.Temperature),
+			slog.Duration("timeout", c.OpenAI.Timeout),
+			slog.Int("prices", len(c.OpenAI.Prices)),
+		),
+		slog.Group("jwt",
+			slog.String("publicKey", secret(c.JWT.PublicKey)),
+			slog.String("jwksUrl", c.JWT.JWKSURL),
+			slog.Duration("jwksRefresh", c.JWT.JWKSRefresh),
+			slog.Any("algorithms", c.JWT.Algorithms),
+			slog.Any("audiences", c.JWT.Audiences),
+			slog.Any("issuers", c.JWT.Issuers),
+			slog.Any("requiredClaims", c.JWT.RequiredClaims),
+			slog.Duration("leeway", c.JWT.Leeway),
+			slog.Duration("maxAge", c.JWT.MaxAge),
+			slog.Bool("enforceScopes", c.JWT.EnforceScopes),
+			slog.String("revocationFile", c.JWT.RevocationFile),
+			slog.Duration("oneTimeTtl", c.JWT.OneTimeTTL),
+			slog.String("subject", c.JWT.Subject),
+		),
+		slog.Group("store",
+			slog.String("backend", c.Store.Backend),
+			slog.String("redisUrl", redactURL(c.Store.RedisURL)),
+			slog.String("quotaFile", c.Store.QuotaFile),
+		),
+		slog.Group("rateLimit",
+			slog.Int("burst", c.RateLimit.Burst),
+			slog.Duration("refill", c.RateLimit.Refill),
+		),
+		slog.Group("budget",
+			slog.Float64("dailyUsd", c.Budget.DailyUSD),
+			slog.Float64("monthlyUsd", c.Budget.MonthlyUSD),
+			slog.String("fallbackModel", c.Budget.FallbackModel),
+		),
+		slog.Group("log",
+			slog.String("format", string(c.Log.Format)),
+			slog.String("level", c.Log.Level),
+			slog.String("projectId", c.Log.ProjectID),
+		),
+		slog.Group("trace",
+			slog.String("exporter", string(c.Trace.Exporter)),
+			slog.String("otlpEndpoint", c.Trace.OTLPEndpoint),
+		),
+		slog.Group("server",
+			slog.String("addr", c.Server.Addr),
+			slog.Duration("readTimeout", c.Server.ReadTimeout),
+			slog.Duration("writeTimeout", c.Server.WriteTimeout),
+			slog.Duration("idleTimeout", c.Server.IdleTimeout),
+			slog.Duration("shutdownTimeout", c.Server.ShutdownTimeout),
+			slog.Bool("tls", c.Server.TLSCertFile != ""),
+		),
+		slog.Group("admin",
+			slog.String("token", secret(c.Admin.Token)),
+			slog.String("metricsToken", secret(c.Admin.MetricsToken)),
+		),
+	)
+}
+
+// secret shows whether a secret is set without revealing it.
+func secret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return secret(raw)
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/logging"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/tracing"
+)
+
+// FileEnv names the configuration file if the -config flag is not given.
+const FileEnv = "CONFIG_FILE"
+
+// setting binds a field to its environment variable and flag.
+type setting struct {
+	env string
+	// flag is empty for secrets, which do not belong on the command line.
+	flag  string
+	usage string
+	value flag.Value
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"OPENAI_API_KEY", "", "OpenAI API key", newValue(&c.OpenAI.APIKey, parseString)},
+		{"OPENAI_API_URL", "openai-api-url", "OpenAI chat completions URL", newValue(&c.OpenAI.APIURL, parseString)},
+		{"OPENAI_MODEL", "openai-model", "OpenAI model", newValue(&c.OpenAI.Model, parseString)},
+		{"OPENAI_MAX_TOKENS", "openai-max-tokens", "Maximum completion tokens", newValue(&c.OpenAI.MaxTokens, strconv.Atoi)},
+		{"OPENAI_TEMPERATURE", "openai-temperature", "Sampling temperature between 0 and 2", newValue(&c.OpenAI.Temperature, parseFloat)},
+		{"OPENAI_TIMEOUT", "openai-timeout", "Timeout of OpenAI calls", newValue(&c.OpenAI.Timeout, time.ParseDuration)},
+		{"OPENAI_PRICES", "", `Prices per model as JSON, e.g. {"gpt-4o-mini": {"inputPerMillion": 0.15, "outputPerMillion": 0.6}}`, jsonValue{&c.OpenAI.Prices}},
+		{"JWT_SECRET", "", "PEM-encoded public key that verifies tokens", newValue(&c.JWT.PublicKey, parseString)},
+		{"JWT_JWKS_URL", "jwt-jwks-url", "JWKS URL that serves the keys that verify tokens, instead of JWT_SECRET", newValue(&c.JWT.JWKSURL, parseString)},
+		{"JWT_JWKS_REFRESH", "jwt-jwks-refresh", "How often the keys are fetched from the JWKS URL", newValue(&c.JWT.JWKSRefresh, time.ParseDuration)},
+		{"JWT_ALGORITHMS", "jwt-algorithms", "Comma-separated signing algorithms tokens may use, of RS256, ES256 and EdDSA", listValue{&c.JWT.Algorithms}},
+		{"JWT_AUDIENCE", "jwt-audience", "Comma-separated audiences tokens may be issued for", listValue{&c.JWT.Audiences}},
+		{"JWT_ISSUERS", "jwt-issuers", "Comma-separated accepted token issuers, any if empty", listValue{&c.JWT.Issuers}},
+		{"JWT_REQUIRED_CLAIMS", "jwt-required-claims", "Comma-separated claims every token must have", listValue{&c.JWT.RequiredClaims}},
+		{"JWT_LEEWAY", "jwt-leeway", "Allowed clock skew when checking exp, nbf and iat", newValue(&c.JWT.Leeway, time.ParseDuration)},
+		{"JWT_ENFORCE_SCOPES", "jwt-enforce-scopes", "Require the haiku:* scopes for the endpoint and premium options; enable once the auth server issues them", newValue(&c.JWT.EnforceScopes, strconv.ParseBool)},
+		{"JWT_MAX_AGE", "jwt-max-age", "Maximum token age since iat, 0 for none", newValue(&c.JWT.MaxAge, time.ParseDuration)},
+		{"JWT_REVOCATION_FILE", "jwt-revocation-file", "File that persists the IDs of revoked and used tokens of the memory backend", newValue(&c.JWT.RevocationFile, parseString)},
+		{"JWT_ONE_TIME_TTL", "jwt-one-time-ttl", "Tokens that live at most this long may only be used once, 0 for none", newValue(&c.JWT.OneTimeTTL, time.ParseDuration)},
+		{"JWT_SUBJECT", "jwt-subject", "Subject of tokens issued for local testing", newValue(&c.JWT.Subject, parseString)},
+		{"STORE_BACKEND", "store-backend", "Store backend, memory or redis", newValue(&c.Store.Backend, parseString)},
+		{"REDIS_URL", "", "Redis URL of the redis backend", newValue(&c.Store.RedisURL, parseString)},
+		{"QUOTA_FILE", "quota-file", "File that persists quota counters of the memory backend", newValue(&c.Store.QuotaFile, parseString)},
+		{"RATE_LIMIT_BURST", "rate-limit-burst", "Requests a subject may send at once", newValue(&c.RateLimit.Burst, strconv.Atoi)},
+		{"RATE_LIMIT_REFILL", "rate-limit-refill", "Time after which a subject regains one request", newValue(&c.RateLimit.Refill, time.ParseDuration)},
+		{"BUDGET_DAILY_USD", "budget-daily-usd", "Daily spend cap in US dollars, 0 for none", newValue(&c.Budget.DailyUSD, parseFloat)},
+		{"BUDGET_MONTHLY_USD", "budget-monthly-usd", "Monthly spend cap in US dollars, 0 for none", newValue(&c.Budget.MonthlyUSD, parseFloat)},
+		{"BUDGET_FALLBACK_MODEL", "budget-fallback-model", "Model used once the budget is exhausted instead of rejecting requests", newValue(&c.Budget.FallbackModel, parseString)},
+		{"LOG_FORMAT", "log-format", "Log format, json, text or gcp", newValue(&c.Log.Format, parseString[logging.Format])},
+		{"LOG_LEVEL", "log-level", "Minimum log level", newValue(&c.Log.Level, parseString)},
+		{"GOOGLE_CLOUD_PROJECT", "log-project-id", "Google Cloud project that traces in logs belong to", newValue(&c.Log.ProjectID, parseString)},
+		{"TRACE_EXPORTER", "trace-exporter", "Trace exporter, none, stdout or otlp", newValue(&c.Trace.Exporter, parseString[tracing.Exporter])},
+		{"TRACE_OTLP_ENDPOINT", "trace-otlp-endpoint", "OTLP/HTTP endpoint URL for traces", newValue(&c.Trace.OTLPEndpoint, parseString)},
+		{"SERVER_ADDR", "addr", "Address the standalone server listens on", newValue(&c.Server.Addr, parseString)},
+		{"SERVER_READ_HEADER_TIMEOUT", "read-header-timeout", "Time allowed to read request headers", newValue(&c.Server.ReadHeaderTimeout, time.ParseDuration)},
+		{"SERVER_READ_TIMEOUT", "read-timeout", "Time allowed to read a whole request", newValue(&c.Server.ReadTimeout, time.ParseDuration)},
+		{"SERVER_WRITE_TIMEOUT", "write-timeout", "Time allowed to serve a request", newValue(&c.Server.WriteTimeout, time.ParseDuration)},
+		{"SERVER_IDLE_TIMEOUT", "idle-timeout", "Time to keep idle connections open", newValue(&c.Server.IdleTimeout, time.ParseDuration)},
+		{"SERVER_SHUTDOWN_TIMEOUT", "shutdown-timeout", "Time allowed for in-flight requests to finish on shutdown", newValue(&c.Server.ShutdownTimeout, time.ParseDuration)},
+		{"TLS_CERT_FILE", "tls-cert", "TLS certificate file, enables HTTPS together with the key", newValue(&c.Server.TLSCertFile, parseString)},
+		{"TLS_KEY_FILE", "tls-key", "TLS private key file", newValue(&c.Server.TLSKeyFile, parseString)},
+		{"ADMIN_TOKEN", "", "Bearer token of the admin endpoints, which are disabled without it", newValue(&c.Admin.Token, parseString)},
+		{"METRICS_TOKEN", "", "Bearer token that scrapes /metrics, which is disabled without it", newValue(&c.Admin.MetricsToken, parseString)},
+	}
+}
+
+// Load reads the configuration from the defaults, the file named by
+// CONFIG_FILE and the environment, and validates it.
+func Load() (Config, error) {
+	return LoadWithFlags(nil, nil)
+}
+
+// LoadWithFlags is Load with flags registered on fs and parsed from args on
+// top. The file may also be named by the -config flag. A nil fs means no
+// flags.
+func LoadWithFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	config := Default()
+	settings := config.settings()
+
+	path := os.Getenv(FileEnv)
+	explicit := map[string]string{}
+	if fs != nil {
+		fs.StringVar(&path, "config", path, "YAML or JSON configuration file ($"+FileEnv+")")
+		for _, s := range settings {
+			if s.flag != "" {
+				fs.Var(s.value, s.flag, s.usage+" ($"+s.env+")")
+			}
+		}
+		if err := fs.Parse(args); err != nil {
+			return config, err
+		}
+		// Flags take precedence, so they are applied again after the file
+		// and the environment.
+		fs.Visit(func(f *flag.Flag) {
+			explicit[f.Name] = f.Value.String()
+		})
+	}
+
+	if path != "" {
+		if err := config.loadFile(path); err != nil {
+			return config, err
+		}
+	}
+
+	for _, s := range settings {
+		if raw, ok := os.LookupEnv(s.env); ok {
+			if err := s.value.Set(raw); err != nil {
+				return config, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if raw, ok := explicit[s.flag]; ok && s.flag != "" {
+			if err := s.value.Set(raw); err != nil {
+				return config, fmt.Errorf("invalid -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, nil
+}
+
+// loadFile decodes a YAML file, or a JSON file since JSON is valid YAML.
+// Unknown keys are an error so that typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open configuration file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// value is a flag.Value that parses into a field of type T.
+type value[T any] struct {
+	ptr   *T
+	parse func(string) (T, error)
+}
+
+func newValue[T any](ptr *T, parse func(string) (T, error)) value[T] {
+	return value[T]{ptr: ptr, parse: parse}
+}
+
+func (v value[T]) Set(raw string) error {
+	parsed, err := v.parse(raw)
+	if err != nil {
+		return err
+	}
+	*v.ptr = parsed
+	return nil
+}
+
+func (v value[T]) String() string {
+	if v.ptr == nil {
+		return ""
+	}
+	return fmt.Sprint(*v.ptr)
+}
+
+func parseString[T ~string](raw string) (T, error) {
+	return T(raw), nil
+}
+
+func parseFloat(raw string) (float64, error) {
+	return strconv.ParseFloat(raw, 64)
+}
+
+// listValue is a flag.Value that parses a comma-separated list.
+type listValue struct {
+	ptr *[]string
+}
+
+func (v listValue) Set(raw string) error {
+	var list []string
+	for item := range strings.SplitSeq(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*v.ptr = list
+	return nil
+}
+
+func (v listValue) String() string {
+	if v.ptr == nil {
+		return ""
+	}
+	return strings.Join(*v.ptr, ",")
+}
+
+// jsonValue is a flag.Value that decodes JSON into a field. Maps are merged
+// with their current entries.
+type jsonValue struct {
+	ptr any
+}
+
+func (v jsonValue) Set(raw string) error {
+	return json.Unmarshal([]byte(raw), v.ptr)
+}
+
+func (v jsonValue) String() string {
+	if v.ptr == nil {
+		return ""
+	}
+	b, _ := json.Marshal(v.ptr)
+	return string(b)
+}
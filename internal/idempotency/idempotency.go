@@ -0,0 +1,148 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	// Header is the request header carrying the client-chosen idempotency key.
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses that were replayed from the store.
+	ReplayedHeader = "Idempotent-Replayed"
+	// MaxKeyLength is the longest idempotency key that is accepted.
+	MaxKeyLength = 255
+	// DefaultTTL is how long responses are kept for replay by default.
+	DefaultTTL = 24 * time.Hour
+	// InFlightTTL is how long a key stays reserved while its request is
+	// served, unless InFlightTTLFor asks for longer. It outlasts the longest
+	// request, so that a crashed request does not block its key for the
+	// whole DefaultTTL.
+	InFlightTTL = 2 * time.Minute
+	// inFlightMargin is the time a request may take besides its upstream
+	// call, e.g. to read the image.
+	inFlightMargin = time.Minute
+)
+
+// InFlightTTLFor returns how long a key stays reserved for requests whose
+// upstream call may take up to timeout. A key that expired while its request
+// is still served would let a retry pay for a second upstream call.
+func InFlightTTLFor(timeout time.Duration) time.Duration {
+	return max(InFlightTTL, timeout+inFlightMargin)
+}
+
+// Response is a recorded HTTP response that can be replayed.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Record is the stored state of an idempotency key.
+type Record struct {
+	Fingerprint string
+	// Response is nil while the original request is still in flight.
+	Response *Response
+}
+
+// Store persists idempotency records. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Reserve atomically claims key for a new request with the given
+	// fingerprint. If the key is already known and not expired, the existing
+	// record is returned and reserved is false. The reservation expires
+	// after ttl unless the key is completed.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (record Record, reserved bool, err error)
+	// Complete stores the response for a reserved key and keeps it for ttl.
+	Complete(ctx context.Context, key string, response Response, ttl time.Duration) error
+	// Release forgets a reserved key so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// Key scopes a client-chosen idempotency key to the subject that sent it.
+func Key(subject, idempotencyKey string) string {
+	sum := sha256.Sum256([]byte(subject + "\x00" + idempotencyKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint identifies a request body, so that a reused key with a
+// different body can be told apart from a retry. JSON bodies are compared
+// by value, so that the order of keys and the whitespace do not matter.
+func Fingerprint(body []byte) string {
+	sum := sha256.Sum256(canonicalJSON(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalJSON re-encodes body with sorted object keys and without
+// whitespace. Bodies that are not JSON are returned as they are.
+func canonicalJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return body
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+// Replay writes a stored response to w.
+func (r *Response) Replay(w http.ResponseWriter) {
+	for name, values := range r.Header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(r.StatusCode)
+	w.Write(r.Body)
+}
+
+// Recorder is an http.ResponseWriter that writes through to the wrapped
+// writer while recording the response for later replay.
+type Recorder struct {
+	http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+}
+
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+func (r *Recorder) WriteHeader(statusCode int) {
+	if r.statusCode != 0 {
+		return
+	}
+	r.statusCode = statusCode
+	r.header = r.ResponseWriter.Header().Clone()
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Response returns what has been written so far.
+func (r *Recorder) Response() Response {
+	statusCode := r.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	return Response{
+		StatusCode: statusCode,
+		Header:     r.header,
+		Body:       bytes.Clone(r.body.Bytes()),
+	}
+}
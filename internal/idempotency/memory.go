@@ -0,0 +1,119 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// DefaultMaxEntries bounds the records a MemoryStore keeps.
+const DefaultMaxEntries = 10000
+
+type memoryEntry struct {
+	record    Record
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-process Store. Records are lost on restart and are not
+// shared between instances. Once it holds DefaultMaxEntries records, the
+// completed record that expires first makes room for a new one.
+type MemoryStore struct {
+	mu         sync.Mutex
+	entries    map[string]memoryEntry
+	maxEntries int
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:    make(map[string]memoryEntry),
+		maxEntries: DefaultMaxEntries,
+		now:        time.Now,
+	}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, key, fingerprint string, ttl time.Duration) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expiresAt) {
+		return entry.record, false, nil
+	}
+
+	if len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+
+	record := Record{Fingerprint: fingerprint}
+	s.entries[key] = memoryEntry{record: record, expiresAt: now.Add(ttl)}
+	return record, true, nil
+}
+
+func (s *MemoryStore) Complete(_ context.Context, key string, response Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	entry.record.Response = &response
+	entry.expiresAt = s.now().Add(ttl)
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops expired entries. It runs at most once per sweepInterval to keep
+// Reserve cheap.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// evict drops expired entries, or else the entry that expires first.
+// Completed entries go before in-flight ones, whose requests could otherwise
+// run twice.
+func (s *MemoryStore) evict(now time.Time) {
+	s.lastSweep = time.Time{}
+	s.sweep(now)
+	if len(s.entries) < s.maxEntries {
+		return
+	}
+
+	var victim string
+	var victimEntry memoryEntry
+	for key, entry := range s.entries {
+		if victim == "" || evictsBefore(entry, victimEntry) {
+			victim, victimEntry = key, entry
+		}
+	}
+	delete(s.entries, victim)
+}
+
+func evictsBefore(a, b memoryEntry) bool {
+	if (a.record.Response == nil) != (b.record.Response == nil) {
+		return a.record.Response != nil
+	}
+	return a.expiresAt.Before(b.expiresAt)
+}
@@ -0,0 +1,141 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	_, reserved, err := store.Reserve(ctx, "key", "fingerprint", time.Hour)
+	if err != nil || !reserved {
+		t.Fatalf("Expected first reservation to succeed, got reserved=%v err=%v", reserved, err)
+	}
+
+	record, reserved, err := store.Reserve(ctx, "key", "fingerprint", time.Hour)
+	if err != nil || reserved {
+		t.Fatalf("Expected second reservation to fail, got reserved=%v err=%v", reserved, err)
+	}
+	if record.Response != nil {
+		t.Fatalf("Expected in-flight record without response, got %+v", record.Response)
+	}
+
+	response := Response{StatusCode: http.StatusOK, Body: []byte("EXAMPLE_BODY")}
+	if err := store.Complete(ctx, "key", response, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	record, _, _ = store.Reserve(ctx, "key", "other", time.Hour)
+	if record.Fingerprint != "fingerprint" {
+		t.Errorf("Expected stored fingerprint, got %q", record.Fingerprint)
+	}
+	if record.Response == nil || string(record.Response.Body) != "EXAMPLE_BODY" {
+		t.Errorf("Expected stored response, got %+v", record.Response)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, reserved, _ := store.Reserve(ctx, "key", "fingerprint", time.Hour); !reserved {
+		t.Errorf("Expected expired key to be reserved again")
+	}
+
+	if err := store.Release(ctx, "key"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, reserved, _ := store.Reserve(ctx, "key", "fingerprint", time.Hour); !reserved {
+		t.Errorf("Expected released key to be reserved again")
+	}
+}
+
+func TestKeyIsScopedToSubject(t *testing.T) {
+	if Key("alice", "key") == Key("bob", "key") {
+		t.Errorf("Expected keys of different subjects to differ")
+	}
+}
+
+func TestMemoryStoreInFlightExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	store.Reserve(ctx, "crashed", "fingerprint", InFlightTTL)
+	store.Reserve(ctx, "completed", "fingerprint", InFlightTTL)
+	store.Complete(ctx, "completed", Response{StatusCode: http.StatusOK}, DefaultTTL)
+
+	now = now.Add(InFlightTTL)
+	if _, reserved, _ := store.Reserve(ctx, "crashed", "fingerprint", InFlightTTL); !reserved {
+		t.Errorf("Expected the key of a crashed request to be reserved again")
+	}
+	if record, reserved, _ := store.Reserve(ctx, "completed", "fingerprint", InFlightTTL); reserved || record.Response == nil {
+		t.Errorf("Expected the completed response to be kept, got reserved=%v record=%+v", reserved, record)
+	}
+}
+
+func TestInFlightTTLFor(t *testing.T) {
+	cases := []struct {
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{timeout: 30 * time.Second, want: InFlightTTL},
+		{timeout: 5 * time.Minute, want: 5*time.Minute + inFlightMargin},
+	}
+
+	for _, c := range cases {
+		if got := InFlightTTLFor(c.timeout); got != c.want {
+			t.Errorf("InFlightTTLFor(%s): expected %s, got %s", c.timeout, c.want, got)
+		}
+	}
+}
+
+func TestMemoryStoreMaxEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.maxEntries = 2
+
+	store.Reserve(ctx, "in-flight", "fingerprint", InFlightTTL)
+	store.Reserve(ctx, "completed", "fingerprint", InFlightTTL)
+	store.Complete(ctx, "completed", Response{StatusCode: http.StatusOK}, DefaultTTL)
+	if _, reserved, _ := store.Reserve(ctx, "new", "fingerprint", InFlightTTL); !reserved {
+		t.Fatalf("Expected a full store to make room")
+	}
+
+	if len(store.entries) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(store.entries))
+	}
+	if _, ok := store.entries["completed"]; ok {
+		t.Errorf("Expected the completed entry to be evicted before the in-flight one")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	cases := []struct {
+		name      string
+		a, b      string
+		wantEqual bool
+	}{
+		{name: "same body", a: `{"language":"English"}`, b: `{"language":"English"}`, wantEqual: true},
+		{name: "key order", a: `{"language":"English","tone":"playful"}`, b: `{"tone":"playful","language":"English"}`, wantEqual: true},
+		{name: "whitespace", a: `{"language":"English"}`, b: "{ \"language\": \"English\" }\n", wantEqual: true},
+		{name: "different value", a: `{"language":"English"}`, b: `{"language":"Japanese"}`},
+		{name: "number precision", a: `{"n":10000000000000001}`, b: `{"n":10000000000000000}`},
+		{name: "not JSON", a: `EXAMPLE_BODY`, b: `EXAMPLE_OTHER_BODY`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Fingerprint([]byte(c.a)) == Fingerprint([]byte(c.b)); got != c.wantEqual {
+				t.Errorf("Expected equal fingerprints %v, got %v", c.wantEqual, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package imagehash
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+)
+
+const (
+	hashWidth  = 9
+	hashHeight = 8
+
+	// MaxPixels bounds the images that are decoded. A small file can claim
+	// huge dimensions, and decoding it would take gigabytes of memory.
+	MaxPixels = 4096 * 4096
+
+	// maxSamples bounds the pixels read per axis when shrinking an image.
+	maxSamples = 128
+)
+
+// ErrTooLarge is returned for images with more than MaxPixels pixels.
+var ErrTooLarge = errors.New("image has too many pixels")
+
+// Decode decodes a JPEG or PNG image. Its header is read first, so that
+// images with more than MaxPixels pixels are rejected before they are
+// decoded.
+func Decode(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// DHash computes the 64-bit difference hash of img. The image is shrunk to
+// 9x8 grayscale pixels, and each bit records whether a pixel is brighter than
+// its right neighbour. Recompressed or resized copies of an image produce the
+// same or a very similar hash.
+func DHash(img image.Image) uint64 {
+	pixels := shrink(img)
+
+	var hash uint64
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if pixels[y][x] > pixels[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance returns the number of differing bits of two hashes.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// shrink averages the luminance of img over a hashWidth x hashHeight grid.
+// It reads at most maxSamples pixels per axis, evenly spread, which is plenty
+// for 72 cells.
+func shrink(img image.Image) [hashHeight][hashWidth]float64 {
+	var sums [hashHeight][hashWidth]float64
+	var counts [hashHeight][hashWidth]float64
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return sums
+	}
+
+	samplesX, samplesY := min(width, maxSamples), min(height, maxSamples)
+	for sy := 0; sy < samplesY; sy++ {
+		dy := sy * height / samplesY
+		cellY := dy * hashHeight / height
+		for sx := 0; sx < samplesX; sx++ {
+			dx := sx * width / samplesX
+			cellX := dx * hashWidth / width
+			r, g, b, _ := img.At(bounds.Min.X+dx, bounds.Min.Y+dy).RGBA()
+			sums[cellY][cellX] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cellY][cellX]++
+		}
+	}
+
+	for y := range sums {
+		for x := range sums[y] {
+			if counts[y][x] > 0 {
+				sums[y][x] /= counts[y][x]
+			}
+		}
+	}
+	return sums
+}
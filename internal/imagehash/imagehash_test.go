@@ -0,0 +1,125 @@
+package imagehash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func gradient(width, height int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x*255/width + y*128/height) / 2)
+			if flip {
+				v = 255 - v
+			}
+			if (x/(width/4)+y/(height/4))%2 == 0 {
+				v /= 2
+			}
+			img.Set(x, y, color.RGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+func recompress(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	decoded, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to decode JPEG: %v", err)
+	}
+	return decoded
+}
+
+func TestDHash(t *testing.T) {
+	original := gradient(320, 240, false)
+
+	cases := []struct {
+		name        string
+		other       image.Image
+		wantMaxDist int
+		wantMinDist int
+	}{
+		{
+			name:        "same image",
+			other:       original,
+			wantMaxDist: 0,
+		},
+		{
+			name:        "recompressed image",
+			other:       recompress(t, original, 40),
+			wantMaxDist: 4,
+		},
+		{
+			name:        "resized image",
+			other:       gradient(160, 120, false),
+			wantMaxDist: 4,
+		},
+		{
+			name:        "larger image",
+			other:       gradient(1280, 960, false),
+			wantMaxDist: 4,
+		},
+		{
+			name:        "different image",
+			other:       gradient(320, 240, true),
+			wantMinDist: 12,
+			wantMaxDist: 64,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			distance := Distance(DHash(original), DHash(c.other))
+			if distance > c.wantMaxDist || distance < c.wantMinDist {
+				t.Errorf("Expected distance between %d and %d, got %d", c.wantMinDist, c.wantMaxDist, distance)
+			}
+		})
+	}
+}
+
+// pngHeader returns the start of a PNG that claims the given dimensions,
+// which is all that is read before the size check.
+func pngHeader(width, height uint32) []byte {
+	ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestDecodeRejectsHugeImages(t *testing.T) {
+	if _, err := Decode(pngHeader(100000, 100000)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected %v, got %v", ErrTooLarge, err)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gradient(320, 240, false), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	if _, err := Decode(buf.Bytes()); err != nil {
+		t.Errorf("Expected a normal image to decode, got %v", err)
+	}
+}
+
+func BenchmarkDHash(b *testing.B) {
+	img := gradient(4000, 3000, false)
+
+	for b.Loop() {
+		DHash(img)
+	}
+}
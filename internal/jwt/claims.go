@@ -0,0 +1,158 @@
+package jwt
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// registeredClaims have a field in Claims and are left out of Custom.
+var registeredClaims = []string{"sub", "iss", "aud", "jti", "iat", "nbf", "exp", "scope", "scp", "plan"}
+
+// Claims holds the verified claims of a token.
+type Claims struct {
+	Subject  string
+	Issuer   string
+	Audience []string
+	// ID is the jti claim.
+	ID        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// Scopes come from the space-separated scope claim or the scp array.
+	Scopes []string
+	// Plan selects the caller's quota plan.
+	Plan string
+	// Custom holds all other claims, such as those of the app.
+	Custom map[string]any
+}
+
+// newClaims reads the claims of a token that passed validateClaims.
+func newClaims(claims jwt.MapClaims) Claims {
+	c := Claims{Custom: map[string]any{}}
+	c.Subject, _ = claims["sub"].(string)
+	c.Issuer, _ = claims["iss"].(string)
+	c.Audience, _ = audiences(claims)
+	c.ID, _ = claims["jti"].(string)
+	c.IssuedAt, _, _ = numericDate(claims, "iat")
+	c.ExpiresAt, _, _ = numericDate(claims, "exp")
+	c.Plan, _ = claims["plan"].(string)
+
+	if scope, ok := claims["scope"].(string); ok {
+		c.Scopes = strings.Fields(scope)
+	}
+	if scp, ok := claims["scp"].([]any); ok {
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				c.Scopes = append(c.Scopes, s)
+			}
+		}
+	}
+
+	for name, value := range claims {
+		if !slices.Contains(registeredClaims, name) {
+			c.Custom[name] = value
+		}
+	}
+	return c
+}
+
+// validateClaims checks the registered claims of a token whose signature was
+// verified.
+func (v *Verifier) validateClaims(claims jwt.MapClaims) error {
+	for _, name := range v.requiredClaims {
+		if value, ok := claims[name]; !ok || value == nil || value == "" {
+			return fmt.Errorf("%w: %s", ErrMissingClaim, name)
+		}
+	}
+
+	now := v.now()
+
+	exp, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if ok && now.After(exp.Add(v.leeway)) {
+		return fmt.Errorf("%w: expired at %s", ErrTokenExpired, exp.UTC().Format(time.RFC3339))
+	}
+
+	nbf, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.leeway).Before(nbf) {
+		return fmt.Errorf("%w: not before %s", ErrTokenNotYetValid, nbf.UTC().Format(time.RFC3339))
+	}
+
+	iat, ok, err := numericDate(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.leeway).Before(iat) {
+		return fmt.Errorf("%w: issued in the future at %s", ErrTokenNotYetValid, iat.UTC().Format(time.RFC3339))
+	}
+	if v.maxAge > 0 {
+		if !ok {
+			return fmt.Errorf("%w: iat", ErrMissingClaim)
+		}
+		if now.Sub(iat) > v.maxAge+v.leeway {
+			return fmt.Errorf("%w: issued at %s, more than %s ago", ErrTokenTooOld, iat.UTC().Format(time.RFC3339), v.maxAge)
+		}
+	}
+
+	if len(v.issuers) > 0 {
+		iss, _ := claims["iss"].(string)
+		if !slices.Contains(v.issuers, iss) {
+			return fmt.Errorf("%w: %q", ErrInvalidIssuer, iss)
+		}
+	}
+
+	aud, err := audiences(claims)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(aud, func(a string) bool { return slices.Contains(v.audiences, a) }) {
+		return fmt.Errorf("%w: %q", ErrInvalidAudience, aud)
+	}
+
+	return nil
+}
+
+// numericDate returns a time claim, which is in seconds since the epoch.
+func numericDate(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	seconds, ok := value.(float64)
+	if !ok || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, false, fmt.Errorf("%w: %s must be a number", ErrInvalidClaim, name)
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// audiences returns the aud claim, which is a string or an array of strings.
+func audiences(claims jwt.MapClaims) ([]string, error) {
+	switch aud := claims["aud"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{aud}, nil
+	case []any:
+		list := make([]string, 0, len(aud))
+		for _, a := range aud {
+			s, ok := a.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: aud must only contain strings", ErrInvalidClaim)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("%w: aud must be a string or an array of strings", ErrInvalidClaim)
+	}
+}
@@ -0,0 +1,196 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt"
+)
+
+func signClaims(t *testing.T, keyPair KeyPair, claims gojwt.MapClaims) string {
+	t.Helper()
+
+	key, err := loadPrivateKey(keyPair.Private)
+	if err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	token, err := gojwt.NewWithClaims(gojwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestVerifierClaims(t *testing.T) {
+	keyPair, err := GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	// claims returns valid claims with the given changes; nil values remove
+	// a claim.
+	claims := func(changes gojwt.MapClaims) gojwt.MapClaims {
+		c := gojwt.MapClaims{
+			"sub": DefaultSubject,
+			"aud": "EXAMPLE_AUDIENCE",
+			"iss": "https://auth.example.com",
+			"iat": now.Add(-time.Minute).Unix(),
+			"exp": now.Add(time.Minute).Unix(),
+			"jti": "EXAMPLE_ID",
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+			} else {
+				c[name] = value
+			}
+		}
+		return c
+	}
+
+	config := VerifierConfig{
+		PublicKey: keyPair.Public,
+		Audiences: []string{"EXAMPLE_AUDIENCE", "EXAMPLE_OTHER_AUDIENCE"},
+		Issuers:   []string{"https://auth.example.com"},
+		Leeway:    10 * time.Second,
+		MaxAge:    time.Hour,
+	}
+
+	cases := []struct {
+		name    string
+		claims  gojwt.MapClaims
+		config  func(*VerifierConfig)
+		wantErr error
+	}{
+		{name: "valid", claims: claims(nil)},
+		{name: "audience array", claims: claims(gojwt.MapClaims{"aud": []any{"EXAMPLE_UNKNOWN_AUDIENCE", "EXAMPLE_OTHER_AUDIENCE"}})},
+		{name: "audience array without accepted audience", claims: claims(gojwt.MapClaims{"aud": []any{"EXAMPLE_UNKNOWN_AUDIENCE"}}), wantErr: ErrInvalidAudience},
+		{name: "other audience", claims: claims(gojwt.MapClaims{"aud": "EXAMPLE_UNKNOWN_AUDIENCE"}), wantErr: ErrInvalidAudience},
+		{name: "missing audience", claims: claims(gojwt.MapClaims{"aud": nil}), wantErr: ErrInvalidAudience},
+		{name: "malformed audience", claims: claims(gojwt.MapClaims{"aud": 42}), wantErr: ErrInvalidClaim},
+		{name: "other issuer", claims: claims(gojwt.MapClaims{"iss": "https://staging.auth.example.com"}), wantErr: ErrInvalidIssuer},
+		{name: "missing issuer", claims: claims(gojwt.MapClaims{"iss": nil}), wantErr: ErrInvalidIssuer},
+		{name: "any issuer", claims: claims(gojwt.MapClaims{"iss": nil}), config: func(c *VerifierConfig) { c.Issuers = nil }},
+		{name: "missing subject", claims: claims(gojwt.MapClaims{"sub": nil}), wantErr: ErrMissingClaim},
+		{name: "empty subject", claims: claims(gojwt.MapClaims{"sub": ""}), wantErr: ErrMissingClaim},
+		{name: "missing expiry", claims: claims(gojwt.MapClaims{"exp": nil}), wantErr: ErrMissingClaim},
+		{name: "missing token ID", claims: claims(gojwt.MapClaims{"jti": nil})},
+		{name: "required token ID", claims: claims(gojwt.MapClaims{"jti": nil}), config: func(c *VerifierConfig) { c.RequiredClaims = []string{"sub", "exp", "jti"} }, wantErr: ErrMissingClaim},
+		{name: "custom required claim", claims: claims(nil), config: func(c *VerifierConfig) { c.RequiredClaims = []string{"sub", "exp", "device"} }, wantErr: ErrMissingClaim},
+		{name: "no required claims", claims: claims(gojwt.MapClaims{"exp": nil}), config: func(c *VerifierConfig) { c.RequiredClaims = []string{} }},
+		{name: "expired within leeway", claims: claims(gojwt.MapClaims{"exp": now.Add(-5 * time.Second).Unix()})},
+		{name: "expired", claims: claims(gojwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}), wantErr: ErrTokenExpired},
+		{name: "malformed expiry", claims: claims(gojwt.MapClaims{"exp": "tomorrow"}), wantErr: ErrInvalidClaim},
+		{name: "not before within leeway", claims: claims(gojwt.MapClaims{"nbf": now.Add(5 * time.Second).Unix()})},
+		{name: "not before", claims: claims(gojwt.MapClaims{"nbf": now.Add(time.Minute).Unix()}), wantErr: ErrTokenNotYetValid},
+		{name: "issued in the future", claims: claims(gojwt.MapClaims{"iat": now.Add(time.Minute).Unix()}), wantErr: ErrTokenNotYetValid},
+		{name: "older than maximum age", claims: claims(gojwt.MapClaims{"iat": now.Add(-2 * time.Hour).Unix()}), wantErr: ErrTokenTooOld},
+		{name: "maximum age without issued at", claims: claims(gojwt.MapClaims{"iat": nil}), wantErr: ErrMissingClaim},
+		{name: "no maximum age", claims: claims(gojwt.MapClaims{"iat": nil}), config: func(c *VerifierConfig) { c.MaxAge = 0 }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := config
+			if c.config != nil {
+				c.config(&config)
+			}
+			verifier, err := NewVerifier(config)
+			if err != nil {
+				t.Fatalf("Failed to create verifier: %v", err)
+			}
+			verifier.now = func() time.Time { return now }
+
+			_, err = verifier.Verify(context.Background(), signClaims(t, keyPair, c.claims))
+			if c.wantErr == nil && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if c.wantErr != nil && !errors.Is(err, c.wantErr) {
+				t.Errorf("Expected %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifierReturnsClaims(t *testing.T) {
+	keyPair, err := GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	verifier, err := NewVerifier(VerifierConfig{PublicKey: keyPair.Public})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	iat := time.Now().Add(-time.Minute).Truncate(time.Second)
+	exp := iat.Add(DefaultTTL)
+
+	cases := []struct {
+		name       string
+		claims     gojwt.MapClaims
+		wantScopes []string
+	}{
+		{name: "scope string", claims: gojwt.MapClaims{"scope": "haiku:compose  haiku:hd"}, wantScopes: []string{"haiku:compose", "haiku:hd"}},
+		{name: "scp array", claims: gojwt.MapClaims{"scp": []any{"haiku:compose", "haiku:batch"}}, wantScopes: []string{"haiku:compose", "haiku:batch"}},
+		{name: "no scopes", claims: gojwt.MapClaims{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			tokenClaims := gojwt.MapClaims{
+				"sub":      "EXAMPLE_SUBJECT",
+				"iss":      "EXAMPLE_ISSUER",
+				"aud":      []any{DefaultAudience, "EXAMPLE_AUDIENCE"},
+				"jti":      "EXAMPLE_ID",
+				"iat":      iat.Unix(),
+				"exp":      exp.Unix(),
+				"plan":     "premium",
+				"device":   "EXAMPLE_DEVICE",
+				"appBuild": float64(42),
+			}
+			for name, value := range c.claims {
+				tokenClaims[name] = value
+			}
+
+			claims, err := verifier.Verify(context.Background(), signClaims(t, keyPair, tokenClaims))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			want := Claims{
+				Subject:   "EXAMPLE_SUBJECT",
+				Issuer:    "EXAMPLE_ISSUER",
+				Audience:  []string{DefaultAudience, "EXAMPLE_AUDIENCE"},
+				ID:        "EXAMPLE_ID",
+				IssuedAt:  iat,
+				ExpiresAt: exp,
+				Scopes:    c.wantScopes,
+				Plan:      "premium",
+				Custom:    map[string]any{"device": "EXAMPLE_DEVICE", "appBuild": float64(42)},
+			}
+			if !reflect.DeepEqual(claims, want) {
+				t.Errorf("Expected claims %+v, got %+v", want, claims)
+			}
+		})
+	}
+}
+
+func TestClaimsContext(t *testing.T) {
+	if _, ok := ClaimsFromContext(context.Background()); ok {
+		t.Errorf("Expected no claims in an empty context")
+	}
+
+	ctx := WithClaims(context.Background(), Claims{Subject: "EXAMPLE_SUBJECT"})
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.Subject != "EXAMPLE_SUBJECT" {
+		t.Errorf("Expected subject EXAMPLE_SUBJECT, got %+v", claims)
+	}
+}
@@ -0,0 +1,18 @@
+package jwt
+
+import "context"
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of ctx that carries the verified claims of the
+// caller.
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by WithClaims. It reports false
+// for requests that were not authenticated.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
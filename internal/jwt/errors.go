@@ -0,0 +1,15 @@
+package jwt
+
+import "errors"
+
+// Errors of Verify for tokens with a valid signature whose claims are not
+// accepted. They are wrapped with details, so match them with errors.Is.
+var (
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrTokenTooOld      = errors.New("token is too old")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+	ErrMissingClaim     = errors.New("missing claim")
+	ErrInvalidClaim     = errors.New("invalid claim")
+)
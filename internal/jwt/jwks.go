@@ -0,0 +1,285 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJWKSRefresh is how long keys fetched from a JWKS URL are used
+	// before they are fetched again.
+	DefaultJWKSRefresh = time.Hour
+	// DefaultJWKSMinRefresh is the minimum time between two fetches, so that
+	// tokens with made-up key IDs cannot make us hammer the auth server.
+	DefaultJWKSMinRefresh = time.Minute
+
+	maxJWKSSize = 1 << 20
+)
+
+// ErrUnknownKeyID is returned for tokens signed with a key that is not in the
+// key set, even after fetching it again.
+var ErrUnknownKeyID = errors.New("unknown key ID")
+
+// JWKSConfig configures a JWKS.
+type JWKSConfig struct {
+	// URL serves the JSON Web Key Set of the auth server.
+	URL string
+	// Refresh is DefaultJWKSRefresh if zero.
+	Refresh time.Duration
+	// MinRefresh is DefaultJWKSMinRefresh if zero.
+	MinRefresh time.Duration
+	// Client is http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// JWKS is a key set fetched from a JWKS URL. Keys are selected by the kid
+// header of a token. The set is fetched again when it is older than the
+// refresh interval or when a token names an unknown key, but at most once per
+// minimum refresh interval. It is safe for concurrent use.
+type JWKS struct {
+	config JWKSConfig
+	now    func() time.Time
+
+	// refreshMu makes concurrent lookups wait for a single fetch.
+	refreshMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]any
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// NewJWKS returns a key set that is fetched on first use. Call Refresh to
+// fetch it up front.
+func NewJWKS(config JWKSConfig) *JWKS {
+	if config.Refresh == 0 {
+		config.Refresh = DefaultJWKSRefresh
+	}
+	if config.MinRefresh == 0 {
+		config.MinRefresh = DefaultJWKSMinRefresh
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &JWKS{config: config, now: time.Now}
+}
+
+// Refresh fetches the key set. On failure, the previous keys stay in use.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	return j.refresh(ctx)
+}
+
+// refreshIfDue fetches the key set unless that was attempted within the
+// minimum refresh interval, e.g. by a concurrent lookup.
+func (j *JWKS) refreshIfDue(ctx context.Context) {
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+
+	if !j.refreshDue() {
+		return
+	}
+	if err := j.refresh(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to refresh the JWKS", "url", j.config.URL, "error", err)
+	}
+}
+
+func (j *JWKS) refresh(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	attemptedAt := j.attemptedAt
+	j.attemptedAt = j.now()
+	j.mu.Unlock()
+
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about the JWKS, so
+			// the next lookup may fetch it right away.
+			j.mu.Lock()
+			j.attemptedAt = attemptedAt
+			j.mu.Unlock()
+		}
+		return err
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = j.now()
+	j.mu.Unlock()
+	return nil
+}
+
+// Key returns the key with the given ID. A token without a key ID can only be
+// verified if the set has exactly one key.
+func (j *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	key, ok, stale := j.lookup(kid)
+	if ok && !stale {
+		return key, nil
+	}
+
+	j.refreshIfDue(ctx)
+	key, ok, _ = j.lookup(kid)
+
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	return key, nil
+}
+
+func (j *JWKS) lookup(kid string) (key any, ok bool, stale bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	stale = j.now().Sub(j.fetchedAt) >= j.config.Refresh
+	if kid == "" {
+		if len(j.keys) != 1 {
+			return nil, false, stale
+		}
+		for _, key := range j.keys {
+			return key, true, stale
+		}
+	}
+	key, ok = j.keys[kid]
+	return key, ok, stale
+}
+
+// refreshDue reports whether enough time has passed since the last fetch
+// attempt to try again.
+func (j *JWKS) refreshDue() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.attemptedAt.IsZero() || j.now().Sub(j.attemptedAt) >= j.config.MinRefresh
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := j.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode key set: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// One key we cannot use must not take down the others.
+			slog.WarnContext(ctx, "Skipping JWKS key", "kid", k.Kid, "error", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("key set has no usable keys")
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 coordinates")
+		}
+		// The uncompressed point encoding validates that it is on the curve.
+		return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
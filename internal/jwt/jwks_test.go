@@ -0,0 +1,297 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves the public keys of its key pairs, which the test can
+// replace at any time to rotate them.
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	keyPairs map[string]KeyPair
+	requests atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keyPairs map[string]KeyPair) *jwksServer {
+	t.Helper()
+
+	s := &jwksServer{keyPairs: keyPairs}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var set struct {
+			Keys []jwk `json:"keys"`
+		}
+		for kid, keyPair := range s.keyPairs {
+			set.Keys = append(set.Keys, publicJWK(t, keyPair, kid))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// publicJWK encodes the public key of keyPair as a JWK.
+func publicJWK(t *testing.T, keyPair KeyPair, kid string) jwk {
+	t.Helper()
+
+	key, err := loadPublicKey(keyPair.Public)
+	if err != nil {
+		t.Errorf("Failed to load public key: %v", err)
+		return jwk{}
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return jwk{Kty: "RSA", Kid: kid, Use: "sig", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		point, err := key.Bytes()
+		if err != nil {
+			t.Errorf("Failed to encode ECDSA key: %v", err)
+		}
+		return jwk{Kty: "EC", Kid: kid, Use: "sig", Crv: "P-256", X: encode(point[1:33]), Y: encode(point[33:])}
+	case ed25519.PublicKey:
+		return jwk{Kty: "OKP", Kid: kid, Use: "sig", Crv: "Ed25519", X: encode(key)}
+	}
+	t.Errorf("Unexpected key type %T", key)
+	return jwk{}
+}
+
+func (s *jwksServer) rotate(keyPairs map[string]KeyPair) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyPairs = keyPairs
+}
+
+func genKeyPairs(t *testing.T, n int, alg ...string) []KeyPair {
+	t.Helper()
+
+	keyAlg := RS256
+	if len(alg) > 0 {
+		keyAlg = alg[0]
+	}
+
+	keyPairs := make([]KeyPair, n)
+	for i := range keyPairs {
+		keyPair, err := GenKeyPairFor(keyAlg)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key pair: %v", keyAlg, err)
+		}
+		keyPairs[i] = keyPair
+	}
+	return keyPairs
+}
+
+func signedToken(t *testing.T, keyPair KeyPair, kid string) string {
+	t.Helper()
+
+	token, err := JWTForTesting(JWTConfig{
+		KeyPair: keyPair,
+		Sub:     DefaultSubject,
+		Aud:     DefaultAudience,
+		Exp:     time.Minute,
+		KeyID:   kid,
+	})
+	if err != nil {
+		t.Fatalf("Failed to generate JWT: %v", err)
+	}
+	return token
+}
+
+func TestJWKSRotation(t *testing.T) {
+	keyPairs := genKeyPairs(t, 2)
+	server := newJWKSServer(t, map[string]KeyPair{"key-1": keyPairs[0]})
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	jwks := NewJWKS(JWKSConfig{URL: server.URL})
+	jwks.now = func() time.Time { return now }
+
+	verifier, err := NewVerifier(VerifierConfig{JWKS: jwks})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	oldToken := signedToken(t, keyPairs[0], "key-1")
+	newToken := signedToken(t, keyPairs[1], "key-2")
+
+	if _, err := verifier.Verify(context.Background(), oldToken); err != nil {
+		t.Fatalf("Expected the token of the first key to verify, got %v", err)
+	}
+	if got := server.requests.Load(); got != 1 {
+		t.Errorf("Expected 1 fetch, got %d", got)
+	}
+
+	// The auth server starts signing with a second key.
+	server.rotate(map[string]KeyPair{"key-1": keyPairs[0], "key-2": keyPairs[1]})
+	now = now.Add(DefaultJWKSMinRefresh)
+
+	if _, err := verifier.Verify(context.Background(), newToken); err != nil {
+		t.Fatalf("Expected the unknown key to be fetched, got %v", err)
+	}
+	if got := server.requests.Load(); got != 2 {
+		t.Errorf("Expected 2 fetches, got %d", got)
+	}
+	if _, err := verifier.Verify(context.Background(), oldToken); err != nil {
+		t.Errorf("Expected the first key to still verify, got %v", err)
+	}
+
+	// The first key is retired and dropped on the next scheduled refresh.
+	server.rotate(map[string]KeyPair{"key-2": keyPairs[1]})
+	now = now.Add(DefaultJWKSRefresh)
+
+	if _, err := verifier.Verify(context.Background(), oldToken); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("Expected %v, got %v", ErrUnknownKeyID, err)
+	}
+	if _, err := verifier.Verify(context.Background(), newToken); err != nil {
+		t.Errorf("Expected the second key to verify, got %v", err)
+	}
+	if got := server.requests.Load(); got != 3 {
+		t.Errorf("Expected 3 fetches, got %d", got)
+	}
+}
+
+func TestJWKSRefreshIsRateLimited(t *testing.T) {
+	keyPairs := genKeyPairs(t, 2)
+	server := newJWKSServer(t, map[string]KeyPair{"key-1": keyPairs[0]})
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	jwks := NewJWKS(JWKSConfig{URL: server.URL})
+	jwks.now = func() time.Time { return now }
+	if err := jwks.Refresh(context.Background()); err != nil {
+		t.Fatalf("Failed to fetch the JWKS: %v", err)
+	}
+
+	verifier, err := NewVerifier(VerifierConfig{JWKS: jwks})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	// Tokens with made-up key IDs must not trigger a fetch each.
+	forged := signedToken(t, keyPairs[1], "EXAMPLE_KID")
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if _, err := verifier.Verify(context.Background(), forged); err == nil {
+				t.Error("Expected an error for an unknown key ID")
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := server.requests.Load(); got != 1 {
+		t.Errorf("Expected 1 fetch, got %d", got)
+	}
+
+	now = now.Add(DefaultJWKSMinRefresh)
+	verifier.Verify(context.Background(), forged)
+	if got := server.requests.Load(); got != 2 {
+		t.Errorf("Expected 2 fetches after the minimum refresh interval, got %d", got)
+	}
+}
+
+func TestJWKSKeepsKeysWhenRefreshFails(t *testing.T) {
+	keyPairs := genKeyPairs(t, 1)
+	server := newJWKSServer(t, map[string]KeyPair{"key-1": keyPairs[0]})
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	jwks := NewJWKS(JWKSConfig{URL: server.URL})
+	jwks.now = func() time.Time { return now }
+
+	verifier, err := NewVerifier(VerifierConfig{JWKS: jwks})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	token := signedToken(t, keyPairs[0], "key-1")
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	server.Close()
+	now = now.Add(DefaultJWKSRefresh)
+
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Errorf("Expected the cached key to be used, got %v", err)
+	}
+}
+
+func TestJWKSFetchUsesRequestContext(t *testing.T) {
+	keyPairs := genKeyPairs(t, 1)
+	server := newJWKSServer(t, map[string]KeyPair{"key-1": keyPairs[0]})
+
+	verifier, err := NewVerifier(VerifierConfig{JWKS: NewJWKS(JWKSConfig{URL: server.URL})})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	// The client is gone, so the keys are not fetched for it.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := verifier.Verify(ctx, signedToken(t, keyPairs[0], "key-1")); err == nil {
+		t.Errorf("Expected an error for a canceled request")
+	}
+	if got := server.requests.Load(); got != 0 {
+		t.Errorf("Expected no fetch, got %d", got)
+	}
+
+	// The canceled request does not hold back the next fetch.
+	if _, err := verifier.Verify(context.Background(), signedToken(t, keyPairs[0], "key-1")); err != nil {
+		t.Errorf("Expected the token to verify, got %v", err)
+	}
+}
+
+func TestJWKSKeySelection(t *testing.T) {
+	keyPairs := genKeyPairs(t, 2)
+	ecKeyPair := genKeyPairs(t, 1, ES256)[0]
+	edKeyPair := genKeyPairs(t, 1, EdDSA)[0]
+
+	cases := []struct {
+		name     string
+		keyPairs map[string]KeyPair
+		token    string
+		wantErr  bool
+	}{
+		{name: "matching kid", keyPairs: map[string]KeyPair{"key-1": keyPairs[0], "key-2": keyPairs[1]}, token: signedToken(t, keyPairs[1], "key-2")},
+		{name: "ES256 key", keyPairs: map[string]KeyPair{"key-1": keyPairs[0], "key-2": ecKeyPair}, token: signedToken(t, ecKeyPair, "key-2")},
+		{name: "EdDSA key", keyPairs: map[string]KeyPair{"key-1": keyPairs[0], "key-2": edKeyPair}, token: signedToken(t, edKeyPair, "key-2")},
+		{name: "no kid, single key", keyPairs: map[string]KeyPair{"key-1": keyPairs[0]}, token: signedToken(t, keyPairs[0], "")},
+		{name: "no kid, several keys", keyPairs: map[string]KeyPair{"key-1": keyPairs[0], "key-2": keyPairs[1]}, token: signedToken(t, keyPairs[0], ""), wantErr: true},
+		{name: "kid of a key of another type", keyPairs: map[string]KeyPair{"key-1": keyPairs[0], "key-2": ecKeyPair}, token: signedToken(t, keyPairs[0], "key-2"), wantErr: true},
+		{name: "kid of another key", keyPairs: map[string]KeyPair{"key-1": keyPairs[0], "key-2": keyPairs[1]}, token: signedToken(t, keyPairs[0], "key-2"), wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newJWKSServer(t, c.keyPairs)
+			verifier, err := NewVerifier(VerifierConfig{JWKS: NewJWKS(JWKSConfig{URL: server.URL})})
+			if err != nil {
+				t.Fatalf("Failed to create verifier: %v", err)
+			}
+
+			_, err = verifier.Verify(context.Background(), c.token)
+			if (err != nil) != c.wantErr {
+				t.Errorf("Expected error %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
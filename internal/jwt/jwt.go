@@ -1,24 +1,55 @@
 package jwt
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
 const (
-	sub = "img2haiku-backend-demo"
-	aud = "img2haiku-backend"
-	ttl = 15 * time.Minute
+	// DefaultSubject is the subject of tokens issued for local testing.
+	DefaultSubject = "img2haiku-backend-demo"
+	// DefaultAudience is the audience tokens must be issued for.
+	DefaultAudience = "img2haiku-backend"
+	// DefaultTTL is the lifetime of tokens issued for local testing.
+	DefaultTTL = 15 * time.Minute
 )
 
+// Algorithms that tokens may be signed with.
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// DefaultRequiredClaims are the claims a Verifier requires by default. The
+// jti, which identifies a token so that it can be revoked, is not among them,
+// since tokens issued before revocation existed have none.
+var DefaultRequiredClaims = []string{"sub", "exp"}
+
+// SupportedAlgorithms are the algorithms a Verifier accepts by default.
+var SupportedAlgorithms = []string{RS256, ES256, EdDSA}
+
 type JWTConfig struct {
 	KeyPair KeyPair
 	Sub     string
 	Aud     string
-	Exp     time.Duration
+	// Iss is set as the issuer if not empty.
+	Iss string
+	Exp time.Duration
+	// KeyID is set as the kid header if not empty.
+	KeyID string
+	// Claims are added to the token on top of sub, aud, iat, exp and a
+	// random jti.
+	Claims map[string]any
 }
 
+// KeyPair holds PEM-encoded keys. The type of the private key selects the
+// algorithm tokens are signed with.
 type KeyPair struct {
 	Private string
 	Public  string
@@ -31,12 +62,34 @@ func JWTForTesting(config JWTConfig) (string, error) {
 	}
 
 	now := time.Now()
-	jwt := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"sub": config.Sub,
 		"aud": config.Aud,
 		"iat": now.Unix(),
 		"exp": now.Add(config.Exp).Unix(),
-	})
+		"jti": rand.Text(),
+	}
+	if config.Iss != "" {
+		claims["iss"] = config.Iss
+	}
+	for name, value := range config.Claims {
+		claims[name] = value
+	}
+
+	var method jwt.SigningMethod
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	}
+
+	jwt := jwt.NewWithClaims(method, claims)
+	if config.KeyID != "" {
+		jwt.Header["kid"] = config.KeyID
+	}
 
 	jwtString, err := jwt.SignedString(key)
 	if err != nil {
@@ -1,6 +1,10 @@
 package jwt
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -8,8 +12,27 @@ import (
 	"fmt"
 )
 
+// GenKeyPair generates an RSA key pair for RS256 tokens.
 func GenKeyPair() (KeyPair, error) {
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	return GenKeyPairFor(RS256)
+}
+
+// GenKeyPairFor generates a key pair for tokens signed with alg.
+func GenKeyPairFor(alg string) (KeyPair, error) {
+	var (
+		priv crypto.Signer
+		err  error
+	)
+	switch alg {
+	case RS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return KeyPair{}, fmt.Errorf("unsupported algorithm %q", alg)
+	}
 	if err != nil {
 		return KeyPair{}, fmt.Errorf("generate key: %w", err)
 	}
@@ -19,11 +42,11 @@ func GenKeyPair() (KeyPair, error) {
 		return KeyPair{}, fmt.Errorf("marshal privkey: %w", err)
 	}
 	privPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
+		Type:  "PRIVATE KEY",
 		Bytes: privDER,
 	})
 
-	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.Public())
 	if err != nil {
 		return KeyPair{}, fmt.Errorf("marshal pubkey: %w", err)
 	}
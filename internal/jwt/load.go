@@ -1,31 +1,53 @@
 package jwt
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 )
 
-func loadPrivateKey(keyStr string) (*rsa.PrivateKey, error) {
+func loadPrivateKey(keyStr string) (crypto.Signer, error) {
 	if keyStr == "" {
 		return nil, errors.New("keyStr var not set: " + keyStr)
 	}
 
-	keyData := []byte(keyStr)
-	block, _ := pem.Decode(keyData)
+	block, _ := pem.Decode([]byte(keyStr))
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
 	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
 		return nil, err
 	}
-	rsaKey, ok := key.(*rsa.PrivateKey)
-	if !ok {
-		return nil, errors.New("not an RSA private key")
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("not a P-256 ECDSA private key")
+		}
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, errors.New("not an RSA, ECDSA or Ed25519 private key")
 	}
-	return rsaKey, nil
 }
 
-func loadPublicKey(keyStr string) (*rsa.PublicKey, error) {
+// CheckPublicKey reports whether keyStr is a PEM-encoded public key that
+// tokens can be verified with.
+func CheckPublicKey(keyStr string) error {
+	_, err := loadPublicKey(keyStr)
+	return err
+}
+
+// loadPublicKey parses an RSA, P-256 ECDSA or Ed25519 public key.
+func loadPublicKey(keyStr string) (crypto.PublicKey, error) {
 	if keyStr == "" {
 		return nil, errors.New("keyStr var not set: " + keyStr)
 	}
@@ -35,12 +57,21 @@ func loadPublicKey(keyStr string) (*rsa.PublicKey, error) {
 		return nil, errors.New("failed to decode PEM block")
 	}
 
-	if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
-		if rsaPub, ok := pub.(*rsa.PublicKey); ok {
-			return rsaPub, nil
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("unsupported public key format")
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return pub, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("not a P-256 ECDSA public key")
 		}
-		return nil, errors.New("not an RSA public key")
+		return pub, nil
+	case ed25519.PublicKey:
+		return pub, nil
+	default:
+		return nil, errors.New("not an RSA, ECDSA or Ed25519 public key")
 	}
-
-	return nil, errors.New("unsupported public key format")
 }
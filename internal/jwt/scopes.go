@@ -0,0 +1,24 @@
+package jwt
+
+import "slices"
+
+// Scopes that tokens grant in their scope or scp claim.
+const (
+	// ScopeCompose allows composing haiku at all.
+	ScopeCompose = "haiku:compose"
+	// ScopeVariants allows asking for a different haiku for an image that
+	// was sent before.
+	ScopeVariants = "haiku:variants"
+	// ScopeHD allows high-detail image analysis.
+	ScopeHD = "haiku:hd"
+	// ScopeBatch is reserved for composing several haiku in one request.
+	ScopeBatch = "haiku:batch"
+)
+
+// AllScopes are granted to tokens issued for local testing.
+var AllScopes = []string{ScopeCompose, ScopeVariants, ScopeHD, ScopeBatch}
+
+// HasScope reports whether the token grants scope.
+func (c Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
@@ -1,42 +1,25 @@
 package jwt
 
-import (
-	"errors"
-
-	"github.com/golang-jwt/jwt"
-)
+import "context"
 
 func Validate(tokenString string, pubKeyStr string) (bool, error) {
-	key, err := loadPublicKey(pubKeyStr)
-	if err != nil {
+	if _, err := ValidateClaims(tokenString, pubKeyStr); err != nil {
 		return false, err
 	}
+	return true, nil
+}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return key, nil
-	})
-
-	if err != nil {
-		return false, err
-	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if !validateAud(claims) {
-			return false, errors.New("invalid audience")
-		}
-		return true, nil
-	}
-
-	return false, errors.New("invalid token")
+// ValidateClaims validates the token like Validate and returns its claims.
+func ValidateClaims(tokenString string, pubKeyStr string) (Claims, error) {
+	return ValidateClaimsWithAudience(tokenString, pubKeyStr, DefaultAudience)
 }
 
-func validateAud(claims jwt.MapClaims) bool {
-	aud, ok := claims["aud"].(string)
-	if !ok {
-		return false
+// ValidateClaimsWithAudience is ValidateClaims for tokens issued for audience.
+// It parses the key on every call; use a Verifier to verify many tokens.
+func ValidateClaimsWithAudience(tokenString string, pubKeyStr string, audience string) (Claims, error) {
+	verifier, err := NewVerifier(VerifierConfig{PublicKey: pubKeyStr, Audiences: []string{audience}})
+	if err != nil {
+		return Claims{}, err
 	}
-	return aud == "img2haiku-backend"
+	return verifier.Verify(context.Background(), tokenString)
 }
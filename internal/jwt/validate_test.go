@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -28,18 +29,18 @@ func TestValidate(t *testing.T) {
 			name:       "valid JWT",
 			privateKey: keyPair1.Private,
 			publicKey:  keyPair1.Public,
-			sub:        sub,
-			aud:        aud,
-			exp:        ttl,
+			sub:        DefaultSubject,
+			aud:        DefaultAudience,
+			exp:        DefaultTTL,
 			wantValid:  true,
 		},
 		{
 			name:       "invalid signature",
 			privateKey: keyPair2.Private,
 			publicKey:  keyPair1.Public,
-			sub:        sub,
-			aud:        aud,
-			exp:        ttl,
+			sub:        DefaultSubject,
+			aud:        DefaultAudience,
+			exp:        DefaultTTL,
 			wantValid:  false,
 			wantError:  "crypto/rsa: verification error",
 		},
@@ -47,9 +48,9 @@ func TestValidate(t *testing.T) {
 			name:       "invalid audience",
 			privateKey: keyPair1.Private,
 			publicKey:  keyPair1.Public,
-			sub:        sub,
+			sub:        DefaultSubject,
 			aud:        "invalid-audience",
-			exp:        ttl,
+			exp:        DefaultTTL,
 			wantValid:  false,
 			wantError:  "invalid audience",
 		},
@@ -57,11 +58,11 @@ func TestValidate(t *testing.T) {
 			name:       "expired token",
 			privateKey: keyPair1.Private,
 			publicKey:  keyPair1.Public,
-			sub:        sub,
-			aud:        aud,
+			sub:        DefaultSubject,
+			aud:        DefaultAudience,
 			exp:        -time.Minute,
 			wantValid:  false,
-			wantError:  "Token is expired",
+			wantError:  "token is expired",
 		},
 	}
 
@@ -89,8 +90,8 @@ func TestValidate(t *testing.T) {
 				if c.wantError == "" {
 					t.Fatalf("Unexpected error: %v", err)
 				}
-				if err.Error() != c.wantError {
-					t.Fatalf("Expected error message to be %q, got %q", c.wantError, err.Error())
+				if !strings.HasPrefix(err.Error(), c.wantError) {
+					t.Fatalf("Expected error message to start with %q, got %q", c.wantError, err.Error())
 				}
 			}
 		})
@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// VerifierConfig configures a Verifier.
+type VerifierConfig struct {
+	// PublicKey is the PEM-encoded key that tokens are signed with. It is
+	// ignored if JWKS is set.
+	PublicKey string
+	// JWKS selects the key by the kid header of each token.
+	JWKS *JWKS
+	// Algorithms are the signing algorithms tokens may use.
+	// SupportedAlgorithms are used if empty.
+	Algorithms []string
+	// Audiences are the audiences tokens may be issued for; the aud claim
+	// must name at least one. DefaultAudience is used if empty.
+	Audiences []string
+	// Issuers are the accepted values of the iss claim. Any issuer is
+	// accepted if empty.
+	Issuers []string
+	// RequiredClaims must be present and not empty. DefaultRequiredClaims
+	// are used if nil.
+	RequiredClaims []string
+	// Leeway allows for clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+	// MaxAge rejects tokens issued longer ago, even if they have not expired.
+	// Zero means no limit.
+	MaxAge time.Duration
+}
+
+// Verifier verifies tokens with a key that is parsed once, when the
+// Verifier is built, or with the keys of a JWKS. It is safe for concurrent
+// use.
+type Verifier struct {
+	key            crypto.PublicKey
+	jwks           *JWKS
+	algorithms     []string
+	audiences      []string
+	issuers        []string
+	requiredClaims []string
+	leeway         time.Duration
+	maxAge         time.Duration
+	now            func() time.Time
+}
+
+func NewVerifier(config VerifierConfig) (*Verifier, error) {
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = SupportedAlgorithms
+	}
+	for _, alg := range algorithms {
+		if !slices.Contains(SupportedAlgorithms, alg) {
+			return nil, fmt.Errorf("unsupported algorithm %q", alg)
+		}
+	}
+
+	audiences := config.Audiences
+	if len(audiences) == 0 {
+		audiences = []string{DefaultAudience}
+	}
+	requiredClaims := config.RequiredClaims
+	if requiredClaims == nil {
+		requiredClaims = DefaultRequiredClaims
+	}
+	if config.Leeway < 0 || config.MaxAge < 0 {
+		return nil, errors.New("leeway and maximum age must not be negative")
+	}
+
+	v := &Verifier{
+		jwks:           config.JWKS,
+		algorithms:     algorithms,
+		audiences:      audiences,
+		issuers:        config.Issuers,
+		requiredClaims: requiredClaims,
+		leeway:         config.Leeway,
+		maxAge:         config.MaxAge,
+		now:            time.Now,
+	}
+	if v.jwks != nil {
+		return v, nil
+	}
+
+	key, err := loadPublicKey(config.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(algorithms, func(alg string) bool { return keyMatches(alg, key) }) {
+		return nil, fmt.Errorf("public key cannot verify any of the algorithms %v", algorithms)
+	}
+	v.key = key
+
+	return v, nil
+}
+
+// Verify validates the token's signature and claims and returns its claims.
+// Rejected claims are reported with the errors in errors.go. ctx bounds the
+// JWKS fetch that a token with an unknown key ID triggers.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (Claims, error) {
+	// The claims are validated below, with leeway.
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		return v.keyFunc(ctx, token)
+	})
+	if err != nil {
+		// Let callers match errors of the key lookup, like ErrUnknownKeyID.
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorUnverifiable != 0 && validationErr.Inner != nil {
+			return Claims{}, validationErr.Inner
+		}
+		return Claims{}, err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		if err := v.validateClaims(claims); err != nil {
+			return Claims{}, err
+		}
+		return newClaims(claims), nil
+	}
+
+	return Claims{}, errors.New("invalid token")
+}
+
+func (v *Verifier) keyFunc(ctx context.Context, token *jwt.Token) (any, error) {
+	alg := token.Method.Alg()
+	if !slices.Contains(v.algorithms, alg) {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	key := v.key
+	if v.jwks != nil {
+		kid, _ := token.Header["kid"].(string)
+		var err error
+		if key, err = v.jwks.Key(ctx, kid); err != nil {
+			return nil, err
+		}
+	}
+
+	// Never let a token pick how our key is used.
+	if !keyMatches(alg, key) {
+		return nil, errors.New("key does not match the signing method")
+	}
+	return key, nil
+}
+
+// keyMatches reports whether key verifies tokens signed with alg.
+func keyMatches(alg string, key crypto.PublicKey) bool {
+	switch alg {
+	case RS256:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case ES256:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		return ok && ecKey.Curve.Params().BitSize == 256
+	case EdDSA:
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	default:
+		return false
+	}
+}
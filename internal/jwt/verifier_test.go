@@ -0,0 +1,247 @@
+package jwt
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt"
+)
+
+func testToken(tb testing.TB, keyPair KeyPair, claims map[string]any) string {
+	tb.Helper()
+
+	token, err := JWTForTesting(JWTConfig{
+		KeyPair: keyPair,
+		Sub:     DefaultSubject,
+		Aud:     DefaultAudience,
+		Exp:     time.Minute,
+		Claims:  claims,
+	})
+	if err != nil {
+		tb.Fatalf("Failed to generate JWT: %v", err)
+	}
+	return token
+}
+
+func TestNewVerifier(t *testing.T) {
+	keyPair, err := GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		publicKey string
+		wantErr   bool
+	}{
+		{name: "valid key", publicKey: keyPair.Public},
+		{name: "empty key", publicKey: "", wantErr: true},
+		{name: "not PEM", publicKey: "EXAMPLE_PUBLIC_KEY", wantErr: true},
+		{name: "private key", publicKey: keyPair.Private, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewVerifier(VerifierConfig{PublicKey: c.publicKey})
+			if (err != nil) != c.wantErr {
+				t.Errorf("Expected error %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerifierVerify(t *testing.T) {
+	keyPair, err := GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	otherKeyPair, err := GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+
+	verifier, err := NewVerifier(VerifierConfig{PublicKey: keyPair.Public, Audiences: []string{"EXAMPLE_AUDIENCE"}})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	withAudience := func(keyPair KeyPair, aud string) string {
+		token, err := JWTForTesting(JWTConfig{
+			KeyPair: keyPair,
+			Sub:     DefaultSubject,
+			Aud:     aud,
+			Exp:     time.Minute,
+			Claims:  map[string]any{"plan": "premium"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to generate JWT: %v", err)
+		}
+		return token
+	}
+
+	cases := []struct {
+		name      string
+		token     string
+		wantErr   string
+		wantClaim Claims
+	}{
+		{name: "valid token", token: withAudience(keyPair, "EXAMPLE_AUDIENCE"), wantClaim: Claims{Subject: DefaultSubject, Plan: "premium"}},
+		{name: "other audience", token: withAudience(keyPair, DefaultAudience), wantErr: "invalid audience"},
+		{name: "other key", token: withAudience(otherKeyPair, "EXAMPLE_AUDIENCE"), wantErr: "crypto/rsa: verification error"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			claims, err := verifier.Verify(context.Background(), c.token)
+			if c.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), c.wantErr) {
+					t.Fatalf("Expected error %q, got %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if claims.Subject != c.wantClaim.Subject || claims.Plan != c.wantClaim.Plan {
+				t.Errorf("Expected claims %+v, got %+v", c.wantClaim, claims)
+			}
+		})
+	}
+}
+
+func TestVerifierConcurrentUse(t *testing.T) {
+	keyPair, err := GenKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	verifier, err := NewVerifier(VerifierConfig{PublicKey: keyPair.Public})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	token := testToken(t, keyPair, nil)
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Go(func() {
+			if _, err := verifier.Verify(context.Background(), token); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// BenchmarkValidateClaims parses the public key for every token, like the
+// handler used to.
+func BenchmarkValidateClaims(b *testing.B) {
+	keyPair, err := GenKeyPair()
+	if err != nil {
+		b.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	token := testToken(b, keyPair, nil)
+
+	for b.Loop() {
+		if _, err := ValidateClaims(token, keyPair.Public); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkVerifierVerify reuses the parsed key of a Verifier.
+func BenchmarkVerifierVerify(b *testing.B) {
+	keyPair, err := GenKeyPair()
+	if err != nil {
+		b.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+	token := testToken(b, keyPair, nil)
+	verifier, err := NewVerifier(VerifierConfig{PublicKey: keyPair.Public})
+	if err != nil {
+		b.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	for b.Loop() {
+		if _, err := verifier.Verify(context.Background(), token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoadPublicKey measures the work a Verifier saves on every request.
+func BenchmarkLoadPublicKey(b *testing.B) {
+	keyPair, err := GenKeyPair()
+	if err != nil {
+		b.Fatalf("Failed to generate RSA key pair: %v", err)
+	}
+
+	for b.Loop() {
+		if _, err := loadPublicKey(keyPair.Public); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestVerifierAlgorithms(t *testing.T) {
+	keyPairs := map[string]KeyPair{}
+	for _, alg := range SupportedAlgorithms {
+		keyPair, err := GenKeyPairFor(alg)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key pair: %v", alg, err)
+		}
+		keyPairs[alg] = keyPair
+	}
+
+	// A token signed with HMAC, using the public key as the secret, must not
+	// verify just because the attacker knows the public key.
+	hmacToken, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, gojwt.MapClaims{
+		"sub": DefaultSubject,
+		"aud": DefaultAudience,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(keyPairs[RS256].Public))
+	if err != nil {
+		t.Fatalf("Failed to sign HMAC token: %v", err)
+	}
+
+	cases := []struct {
+		name          string
+		publicKey     string
+		algorithms    []string
+		token         string
+		wantConfigErr bool
+		wantErr       bool
+	}{
+		{name: "RS256", publicKey: keyPairs[RS256].Public, token: testToken(t, keyPairs[RS256], nil)},
+		{name: "ES256", publicKey: keyPairs[ES256].Public, token: testToken(t, keyPairs[ES256], nil)},
+		{name: "EdDSA", publicKey: keyPairs[EdDSA].Public, token: testToken(t, keyPairs[EdDSA], nil)},
+		{name: "algorithm not allowed", publicKey: keyPairs[ES256].Public, algorithms: []string{RS256, ES256}, token: testToken(t, keyPairs[EdDSA], nil), wantErr: true},
+		{name: "key of another type", publicKey: keyPairs[RS256].Public, token: testToken(t, keyPairs[ES256], nil), wantErr: true},
+		{name: "HMAC with public key", publicKey: keyPairs[RS256].Public, token: hmacToken, wantErr: true},
+		{name: "key unusable with allowed algorithms", publicKey: keyPairs[EdDSA].Public, algorithms: []string{RS256}, wantConfigErr: true},
+		{name: "unsupported algorithm", publicKey: keyPairs[RS256].Public, algorithms: []string{"HS256"}, wantConfigErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			verifier, err := NewVerifier(VerifierConfig{PublicKey: c.publicKey, Algorithms: c.algorithms})
+			if (err != nil) != c.wantConfigErr {
+				t.Fatalf("Expected configuration error %v, got %v", c.wantConfigErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			_, err = verifier.Verify(context.Background(), c.token)
+			if (err != nil) != c.wantErr {
+				t.Errorf("Expected error %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
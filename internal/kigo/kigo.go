@@ -0,0 +1,65 @@
+package kigo
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+const fallbackLanguage = "en"
+
+//go:embed kigo.json
+var kigoJSON []byte
+
+// dictionary maps a language code to the seasonal words of each season.
+var dictionary = mustLoad(kigoJSON)
+
+var languageCodes = map[string]string{
+	"en":       "en",
+	"english":  "en",
+	"ja":       "ja",
+	"japanese": "ja",
+	"日本語":      "ja",
+}
+
+func mustLoad(data []byte) map[string]map[types.Season][]string {
+	var dict map[string]map[types.Season][]string
+	if err := json.Unmarshal(data, &dict); err != nil {
+		panic("kigo: invalid embedded dictionary: " + err.Error())
+	}
+	return dict
+}
+
+// Words returns the seasonal words for the given language and season.
+// Languages without a dictionary of their own fall back to English, in which
+// case translated is true and the caller has to ask for a translation.
+func Words(language string, season types.Season) (words []string, translated bool) {
+	code, ok := languageCodes[strings.ToLower(strings.TrimSpace(language))]
+	if !ok {
+		code = fallbackLanguage
+		translated = true
+	}
+	return dictionary[code][season], translated
+}
+
+// SeasonAt returns the meteorological season of t in the given hemisphere.
+func SeasonAt(t time.Time, hemisphere types.Hemisphere) types.Season {
+	month := t.Month()
+	if hemisphere == types.HemisphereSouthern {
+		month = (month+5)%12 + 1
+	}
+
+	switch month {
+	case time.March, time.April, time.May:
+		return types.SeasonSpring
+	case time.June, time.July, time.August:
+		return types.SeasonSummer
+	case time.September, time.October, time.November:
+		return types.SeasonAutumn
+	default:
+		return types.SeasonWinter
+	}
+}
@@ -0,0 +1,78 @@
+package kigo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+func TestSeasonAt(t *testing.T) {
+	cases := []struct {
+		name       string
+		month      time.Month
+		hemisphere types.Hemisphere
+		want       types.Season
+	}{
+		{name: "northern january", month: time.January, hemisphere: types.HemisphereNorthern, want: types.SeasonWinter},
+		{name: "northern april", month: time.April, hemisphere: types.HemisphereNorthern, want: types.SeasonSpring},
+		{name: "northern july", month: time.July, hemisphere: types.HemisphereNorthern, want: types.SeasonSummer},
+		{name: "northern october", month: time.October, hemisphere: types.HemisphereNorthern, want: types.SeasonAutumn},
+		{name: "northern december", month: time.December, hemisphere: types.HemisphereNorthern, want: types.SeasonWinter},
+		{name: "southern january", month: time.January, hemisphere: types.HemisphereSouthern, want: types.SeasonSummer},
+		{name: "southern april", month: time.April, hemisphere: types.HemisphereSouthern, want: types.SeasonAutumn},
+		{name: "southern july", month: time.July, hemisphere: types.HemisphereSouthern, want: types.SeasonWinter},
+		{name: "southern october", month: time.October, hemisphere: types.HemisphereSouthern, want: types.SeasonSpring},
+		{name: "southern december", month: time.December, hemisphere: types.HemisphereSouthern, want: types.SeasonSummer},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := SeasonAt(time.Date(2025, c.month, 15, 12, 0, 0, 0, time.UTC), c.hemisphere)
+			if got != c.want {
+				t.Errorf("Expected season %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	cases := []struct {
+		name           string
+		language       string
+		season         types.Season
+		wantWord       string
+		wantTranslated bool
+	}{
+		{name: "english", language: "English", season: types.SeasonSpring, wantWord: "cherry blossoms"},
+		{name: "japanese", language: "Japanese", season: types.SeasonAutumn, wantWord: "紅葉"},
+		{name: "japanese native name", language: "日本語", season: types.SeasonWinter, wantWord: "雪"},
+		{name: "unsupported language falls back to english", language: "German", season: types.SeasonSummer, wantWord: "cicada", wantTranslated: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			words, translated := Words(c.language, c.season)
+			if translated != c.wantTranslated {
+				t.Errorf("Expected translated to be %v, got %v", c.wantTranslated, translated)
+			}
+			if len(words) == 0 || words[0] != c.wantWord {
+				t.Errorf("Expected words to start with %q, got %v", c.wantWord, words)
+			}
+		})
+	}
+}
+
+func TestDictionaryCoversAllSeasons(t *testing.T) {
+	for language, seasons := range dictionary {
+		for _, season := range types.Seasons {
+			if len(seasons[season]) == 0 {
+				t.Errorf("Expected kigo for %s in %s, got none", season, language)
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
+)
+
+const redacted = "[REDACTED]"
+
+// maxValueLength bounds logged strings, e.g. model answers in error details.
+const maxValueLength = 1000
+
+// sensitiveKeys are attribute keys whose values never appear in the logs.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"apikey":        true,
+	"api_key":       true,
+	"token":         true,
+	"jwt":           true,
+	"secret":        true,
+	"password":      true,
+	"base64image":   true,
+}
+
+// Format selects how log entries are written.
+type Format string
+
+const (
+	// FormatJSON writes one JSON object per entry.
+	FormatJSON Format = "json"
+	// FormatText writes human-readable key=value lines for local runs.
+	FormatText Format = "text"
+	// FormatGCP writes JSON entries that Google Cloud Logging understands,
+	// with severity, message and trace correlation.
+	FormatGCP Format = "gcp"
+)
+
+// ParseFormat parses a format name, defaulting to JSON.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatText, FormatGCP:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported log format %q, must be one of: json, text, gcp", name)
+	}
+}
+
+// Options configure the handler returned by NewHandler.
+type Options struct {
+	Format Format
+	Level  slog.Leveler
+	// ProjectID is the Google Cloud project that traces belong to. It is
+	// only used by FormatGCP.
+	ProjectID string
+}
+
+// NewHandler returns a handler that redacts sensitive attributes, truncates
+// long strings and adds the request ID and trace from the context.
+func NewHandler(w io.Writer, opts Options) slog.Handler {
+	handlerOpts := &slog.HandlerOptions{
+		Level:       opts.Level,
+		ReplaceAttr: sanitize,
+	}
+
+	var handler slog.Handler
+	switch opts.Format {
+	case FormatText:
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case FormatGCP:
+		handlerOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			return sanitize(groups, gcpAttr(groups, a))
+		}
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	}
+
+	return &contextHandler{
+		Handler:   handler,
+		gcp:       opts.Format == FormatGCP,
+		projectID: opts.ProjectID,
+	}
+}
+
+// ParseLevel parses a level name like "debug" or "warn", defaulting to info.
+func ParseLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+func sanitize(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, Truncate(a.Value.String()))
+	}
+	return a
+}
+
+// gcpAttr renames the built-in attributes to the special fields of Cloud
+// Logging's structured logs.
+func gcpAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.LevelKey:
+		level, _ := a.Value.Any().(slog.Level)
+		return slog.String("severity", severity(level))
+	case slog.MessageKey:
+		return slog.String("message", a.Value.String())
+	}
+	return a
+}
+
+func severity(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError+4:
+		return "CRITICAL"
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// Truncate shortens s to a length that is reasonable for a log entry. It
+// never splits a multi-byte character.
+func Truncate(s string) string {
+	if len(s) <= maxValueLength {
+		return s
+	}
+	end := maxValueLength
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end] + "…"
+}
+
+// contextHandler adds request-scoped attributes from the context to every
+// record: the request ID, the trace and the subject of the verified token.
+type contextHandler struct {
+	slog.Handler
+	gcp       bool
+	projectID string
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("requestId", id))
+	}
+	if trace, ok := TraceFromContext(ctx); ok {
+		record.AddAttrs(h.traceAttrs(trace)...)
+	}
+	if claims, ok := jwt.ClaimsFromContext(ctx); ok && claims.Subject != "" {
+		record.AddAttrs(slog.String("subject", claims.Subject))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) traceAttrs(trace Trace) []slog.Attr {
+	if !h.gcp {
+		return []slog.Attr{slog.String("traceId", trace.TraceID)}
+	}
+
+	name := trace.TraceID
+	if h.projectID != "" {
+		name = "projects/" + h.projectID + "/traces/" + trace.TraceID
+	}
+	attrs := []slog.Attr{
+		slog.String("logging.googleapis.com/trace", name),
+		slog.Bool("logging.googleapis.com/trace_sampled", trace.Sampled),
+	}
+	if trace.SpanID != "" {
+		attrs = append(attrs, slog.String("logging.googleapis.com/spanId", trace.SpanID))
+	}
+	return attrs
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs), gcp: h.gcp, projectID: h.projectID}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name), gcp: h.gcp, projectID: h.projectID}
+}
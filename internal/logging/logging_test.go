@@ -0,0 +1,294 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/jwt"
+)
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, Options{Level: slog.LevelInfo}))
+	ctx := WithRequestID(context.Background(), "EXAMPLE_REQUEST_ID")
+	ctx = jwt.WithClaims(ctx, jwt.Claims{Subject: "EXAMPLE_SUBJECT"})
+
+	logger.InfoContext(ctx, "EXAMPLE_MESSAGE",
+		"Authorization", "Bearer EXAMPLE_TOKEN",
+		"base64Image", "EXAMPLE_BASE64_IMAGE",
+		"details", strings.Repeat("a", 2*maxValueLength),
+		"model", "gpt-4o",
+	)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log entry, got %q: %v", buf.String(), err)
+	}
+
+	cases := []struct {
+		key  string
+		want string
+	}{
+		{key: "msg", want: "EXAMPLE_MESSAGE"},
+		{key: "requestId", want: "EXAMPLE_REQUEST_ID"},
+		{key: "subject", want: "EXAMPLE_SUBJECT"},
+		{key: "Authorization", want: redacted},
+		{key: "base64Image", want: redacted},
+		{key: "details", want: strings.Repeat("a", maxValueLength) + "…"},
+		{key: "model", want: "gpt-4o"},
+	}
+
+	for _, c := range cases {
+		if got := entry[c.key]; got != c.want {
+			t.Errorf("Expected %s to be %q, got %q", c.key, c.want, got)
+		}
+	}
+}
+
+func TestHandlerGCP(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, Options{Format: FormatGCP, Level: slog.LevelInfo, ProjectID: "EXAMPLE_PROJECT"}))
+	ctx := WithTrace(context.Background(), Trace{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true})
+
+	logger.WarnContext(ctx, "EXAMPLE_MESSAGE")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log entry, got %q: %v", buf.String(), err)
+	}
+
+	cases := []struct {
+		key  string
+		want any
+	}{
+		{key: "severity", want: "WARNING"},
+		{key: "message", want: "EXAMPLE_MESSAGE"},
+		{key: "logging.googleapis.com/trace", want: "projects/EXAMPLE_PROJECT/traces/4bf92f3577b34da6a3ce929d0e0e4736"},
+		{key: "logging.googleapis.com/spanId", want: "00f067aa0ba902b7"},
+		{key: "logging.googleapis.com/trace_sampled", want: true},
+	}
+
+	for _, c := range cases {
+		if got := entry[c.key]; got != c.want {
+			t.Errorf("Expected %s to be %v, got %v", c.key, c.want, got)
+		}
+	}
+	for _, key := range []string{"level", "msg"} {
+		if _, ok := entry[key]; ok {
+			t.Errorf("Expected no %s key in a GCP entry", key)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	cases := []struct {
+		name    string
+		want    Format
+		wantErr bool
+	}{
+		{name: "", want: FormatJSON},
+		{name: "text", want: FormatText},
+		{name: "GCP", want: FormatGCP},
+		{name: "xml", wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseFormat(c.name)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParseFormat(%q): expected error %v, got %v", c.name, c.wantErr, err)
+		}
+		if got != c.want {
+			t.Errorf("ParseFormat(%q): expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		name    string
+		s       string
+		wantLen int
+	}{
+		{name: "short", s: "EXAMPLE_VALUE", wantLen: len("EXAMPLE_VALUE")},
+		{name: "long", s: strings.Repeat("a", maxValueLength+1), wantLen: maxValueLength + len("…")},
+		{name: "multi-byte character at the limit", s: "a" + strings.Repeat("古", maxValueLength), wantLen: maxValueLength + len("…")},
+		{name: "multi-byte character across the limit", s: strings.Repeat("古", maxValueLength), wantLen: maxValueLength - 1 + len("…")},
+	}
+
+	for _, c := range cases {
+		got := Truncate(c.s)
+		if len(got) != c.wantLen {
+			t.Errorf("%s: expected length %d, got %d", c.name, c.wantLen, len(got))
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("%s: expected valid UTF-8, got %q", c.name, got)
+		}
+	}
+}
+
+func TestTraceFromRequest(t *testing.T) {
+	cases := []struct {
+		name        string
+		traceparent string
+		cloudTrace  string
+		want        Trace
+		wantOk      bool
+	}{
+		{
+			name:        "traceparent",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			want:        Trace{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true},
+			wantOk:      true,
+		},
+		{
+			name:        "traceparent takes precedence",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			cloudTrace:  "105445aa7843bc8bf206b12000100000/1;o=1",
+			want:        Trace{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"},
+			wantOk:      true,
+		},
+		{
+			name:       "X-Cloud-Trace-Context",
+			cloudTrace: "105445aa7843bc8bf206b12000100000/255;o=1",
+			want:       Trace{TraceID: "105445aa7843bc8bf206b12000100000", SpanID: "00000000000000ff", Sampled: true},
+			wantOk:     true,
+		},
+		{
+			name:        "invalid traceparent falls back",
+			traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			cloudTrace:  "105445aa7843bc8bf206b12000100000",
+			want:        Trace{TraceID: "105445aa7843bc8bf206b12000100000"},
+			wantOk:      true,
+		},
+		{
+			name:       "invalid X-Cloud-Trace-Context",
+			cloudTrace: "EXAMPLE_TRACE/1;o=1",
+		},
+		{
+			name: "no trace headers",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if c.traceparent != "" {
+				req.Header.Set(TraceparentHeader, c.traceparent)
+			}
+			if c.cloudTrace != "" {
+				req.Header.Set(CloudTraceHeader, c.cloudTrace)
+			}
+
+			got, ok := TraceFromRequest(req)
+			if ok != c.wantOk {
+				t.Fatalf("Expected ok %v, got %v", c.wantOk, ok)
+			}
+			if got != c.want {
+				t.Errorf("Expected trace %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	cases := []struct {
+		name      string
+		requestID string
+		wantEcho  bool
+	}{
+		{name: "generates a request ID", requestID: ""},
+		{name: "keeps the client's request ID", requestID: "EXAMPLE_REQUEST_ID", wantEcho: true},
+		{name: "replaces an unsafe request ID", requestID: "EXAMPLE\nREQUEST_ID"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var seen string
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if c.requestID != "" {
+				req.Header.Set(RequestIDHeader, c.requestID)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			echoed := rec.Header().Get(RequestIDHeader)
+			if seen == "" || echoed != seen {
+				t.Errorf("Expected the request ID %q in the context to be echoed, got %q", seen, echoed)
+			}
+			if (echoed == c.requestID) != c.wantEcho {
+				t.Errorf("Expected echo of the client's request ID to be %v, got %q", c.wantEcho, echoed)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(NewHandler(&buf, Options{Format: FormatGCP, Level: slog.LevelInfo})))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("EXAMPLE_BODY"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/compose", strings.NewReader("EXAMPLE_REQUEST"))
+	req.Header.Set("User-Agent", "EXAMPLE_USER_AGENT")
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry struct {
+		Severity    string         `json:"severity"`
+		Trace       string         `json:"logging.googleapis.com/trace"`
+		HTTPRequest map[string]any `json:"httpRequest"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log entry, got %q: %v", buf.String(), err)
+	}
+
+	if entry.Severity != "ERROR" {
+		t.Errorf("Expected severity ERROR for a 502, got %q", entry.Severity)
+	}
+	if entry.Trace != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the trace from traceparent, got %q", entry.Trace)
+	}
+
+	cases := []struct {
+		key  string
+		want any
+	}{
+		{key: "requestMethod", want: http.MethodPost},
+		{key: "requestUrl", want: "/compose"},
+		{key: "status", want: float64(http.StatusBadGateway)},
+		{key: "requestSize", want: "15"},
+		{key: "responseSize", want: "12"},
+		{key: "userAgent", want: "EXAMPLE_USER_AGENT"},
+		{key: "remoteIp", want: "192.0.2.1"},
+	}
+
+	for _, c := range cases {
+		if got := entry.HTTPRequest[c.key]; got != c.want {
+			t.Errorf("Expected httpRequest.%s to be %v, got %v", c.key, c.want, got)
+		}
+	}
+	if latency, _ := entry.HTTPRequest["latency"].(string); !strings.HasSuffix(latency, "s") {
+		t.Errorf("Expected a latency in seconds, got %q", latency)
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Middleware takes the request ID from the X-Request-ID header, or generates
+// one, and the trace from the current span or the trace headers, puts them into the request
+// context and echoes the request ID in the response. Once the request is
+// served it logs an access entry with an httpRequest group in the shape
+// Cloud Logging expects.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		ctx := WithRequestID(r.Context(), id)
+		if trace, ok := traceFromSpan(r.Context()); ok {
+			ctx = WithTrace(ctx, trace)
+		} else if trace, ok := TraceFromRequest(r); ok {
+			ctx = WithTrace(ctx, trace)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if sw.status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(ctx, level, "Request served", httpRequest(r, sw, time.Since(start)))
+	})
+}
+
+// httpRequest describes a served request like Cloud Logging's HttpRequest.
+func httpRequest(r *http.Request, sw *statusWriter, latency time.Duration) slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("requestMethod", r.Method),
+		slog.String("requestUrl", r.URL.String()),
+		slog.Int("status", sw.status()),
+		slog.String("responseSize", strconv.FormatInt(sw.size, 10)),
+		slog.String("userAgent", r.UserAgent()),
+		slog.String("remoteIp", remoteIP(r)),
+		slog.String("protocol", r.Proto),
+		slog.String("latency", strconv.FormatFloat(latency.Seconds(), 'f', 9, 64)+"s"),
+	}
+	if r.ContentLength > 0 {
+		attrs = append(attrs, slog.String("requestSize", strconv.FormatInt(r.ContentLength, 10)))
+	}
+	if referer := r.Referer(); referer != "" {
+		attrs = append(attrs, slog.String("referer", referer))
+	}
+	return slog.Attr{Key: "httpRequest", Value: slog.GroupValue(attrs...)}
+}
+
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// statusWriter records the status code and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+	size int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TraceparentHeader is the W3C Trace Context header.
+	TraceparentHeader = "traceparent"
+	// CloudTraceHeader is the legacy Google Cloud trace header of the form
+	// TRACE_ID/SPAN_ID;o=OPTIONS.
+	CloudTraceHeader = "X-Cloud-Trace-Context"
+)
+
+// Trace identifies the distributed trace a request belongs to.
+type Trace struct {
+	TraceID string
+	// SpanID is the 16 hex digit ID of the caller's span, if known.
+	SpanID  string
+	Sampled bool
+}
+
+type traceKey struct{}
+
+// WithTrace returns a copy of ctx that carries the trace.
+func WithTrace(ctx context.Context, trace Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// TraceFromContext returns the trace of the request ctx belongs to.
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	trace, ok := ctx.Value(traceKey{}).(Trace)
+	return trace, ok
+}
+
+// TraceFromRequest reads the trace from the traceparent header, falling back
+// to X-Cloud-Trace-Context.
+func TraceFromRequest(r *http.Request) (Trace, bool) {
+	if trace, ok := parseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+		return trace, true
+	}
+	return parseCloudTrace(r.Header.Get(CloudTraceHeader))
+}
+
+// traceFromSpan returns the trace of the OpenTelemetry span in ctx, so that
+// log entries point at the span that wrote them.
+func traceFromSpan(ctx context.Context) (Trace, bool) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return Trace{}, false
+	}
+	return Trace{
+		TraceID: sc.TraceID().String(),
+		SpanID:  sc.SpanID().String(),
+		Sampled: sc.IsSampled(),
+	}, true
+}
+
+// parseTraceparent parses a header like
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(header string) (Trace, bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return Trace{}, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || !isHex(traceID) || allZeros(traceID) {
+		return Trace{}, false
+	}
+	if len(spanID) != 16 || !isHex(spanID) || allZeros(spanID) {
+		return Trace{}, false
+	}
+	sampled, err := strconv.ParseUint(flags, 16, 8)
+	if len(flags) != 2 || err != nil {
+		return Trace{}, false
+	}
+
+	return Trace{TraceID: traceID, SpanID: spanID, Sampled: sampled&1 == 1}, true
+}
+
+// parseCloudTrace parses a header like
+// 105445aa7843bc8bf206b12000100000/1;o=1. The span ID is decimal.
+func parseCloudTrace(header string) (Trace, bool) {
+	header, options, _ := strings.Cut(header, ";")
+	traceID, spanID, _ := strings.Cut(header, "/")
+	if len(traceID) != 32 || !isHex(traceID) {
+		return Trace{}, false
+	}
+
+	trace := Trace{
+		TraceID: strings.ToLower(traceID),
+		Sampled: options == "o=1",
+	}
+	if span, err := strconv.ParseUint(spanID, 10, 64); err == nil && span != 0 {
+		trace.SpanID = fmt.Sprintf("%016x", span)
+	}
+	return trace, true
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func allZeros(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
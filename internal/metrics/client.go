@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+const (
+	outcomeSuccess = "success"
+	// outcomeRejected means the model declined the image, e.g. because it
+	// violates the content policy.
+	outcomeRejected = "rejected"
+	outcomeError    = "error"
+)
+
+// Client is a types.Client decorator that records the latency, image size
+// and prompt tokens of calls to the model. It belongs directly in front of
+// the upstream client so that cache hits are not counted.
+type Client struct {
+	next    types.Client
+	metrics *Metrics
+	now     func() time.Time
+}
+
+func NewClient(next types.Client, metrics *Metrics) *Client {
+	return &Client{
+		next:    next,
+		metrics: metrics,
+		now:     time.Now,
+	}
+}
+
+func (c *Client) Call(ctx context.Context, prompt, base64Image string) (types.Haiku, error) {
+	c.metrics.imageSize.Observe(float64(base64.StdEncoding.DecodedLen(len(base64Image))))
+
+	start := c.now()
+	haiku, err := c.next.Call(ctx, prompt, base64Image)
+	elapsed := c.now().Sub(start)
+
+	c.metrics.upstreamDuration.WithLabelValues(model(ctx, haiku), outcome(err)).Observe(elapsed.Seconds())
+	if haiku.Meta != nil && haiku.Meta.Usage.PromptTokens > 0 {
+		c.metrics.promptTokens.Observe(float64(haiku.Meta.Usage.PromptTokens))
+	}
+
+	return haiku, err
+}
+
+// model returns the model that answered, or the requested one if unknown.
+func model(ctx context.Context, haiku types.Haiku) string {
+	if haiku.Meta != nil && haiku.Meta.Model != "" {
+		return haiku.Meta.Model
+	}
+	if info, ok := types.CallInfoFromContext(ctx); ok && info.Model != "" {
+		return info.Model
+	}
+	return "default"
+}
+
+func outcome(err error) string {
+	if err == nil {
+		return outcomeSuccess
+	}
+	var composeErr *types.ComposeError
+	if errors.As(err, &composeErr) && composeErr.StatusCode == http.StatusBadRequest {
+		return outcomeRejected
+	}
+	return outcomeError
+}
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/cache"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+const namespace = "img2haiku"
+
+// codeOK labels requests that did not fail.
+const codeOK = "OK"
+
+// maxSniffLength bounds how much of an error response is buffered to read its
+// error code.
+const maxSniffLength = 4096
+
+// Handler serves the metrics with next to scrapers that send token as a
+// bearer token.
+func Handler(next http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Invalid metrics token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Metrics holds the Prometheus collectors of the service.
+type Metrics struct {
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	cacheResults     *prometheus.CounterVec
+	rateLimited      prometheus.Counter
+	upstreamDuration *prometheus.HistogramVec
+	imageSize        prometheus.Histogram
+	promptTokens     prometheus.Histogram
+}
+
+// New creates the collectors and registers them with reg.
+func New(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
+	return &Metrics{
+		requests: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Compose requests by HTTP status and error code.",
+		}, []string{"status", "code"}),
+		requestDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time to serve a compose request.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30},
+		}, []string{"status"}),
+		cacheResults: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_results_total",
+			Help:      "Compose requests by result cache status (HIT, NEAR-HIT, MISS or BYPASS).",
+		}, []string{"status"}),
+		rateLimited: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_total",
+			Help:      "Compose requests rejected by the rate limiter.",
+		}),
+		upstreamDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_duration_seconds",
+			Help:      "Time of calls to the model by model and outcome (success, rejected or error).",
+			Buckets:   []float64{0.5, 1, 2, 3, 4, 6, 8, 12, 20, 30},
+		}, []string{"model", "outcome"}),
+		imageSize: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "image_size_bytes",
+			Help:      "Size of the decoded images sent to the model.",
+			Buckets:   prometheus.ExponentialBuckets(16<<10, 2, 10),
+		}),
+		promptTokens: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "prompt_tokens",
+			Help:      "Prompt tokens, including image tokens, per call to the model.",
+			Buckets:   prometheus.ExponentialBuckets(128, 2, 8),
+		}),
+	}
+}
+
+// Middleware counts and times the requests served by next, labeled by status
+// and the code of error responses.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &sniffWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		status := strconv.Itoa(sw.status())
+		code := sw.errorCode()
+		m.requests.WithLabelValues(status, code).Inc()
+		m.requestDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
+		if code == string(types.ErrRateLimited) {
+			m.rateLimited.Inc()
+		}
+		if cacheStatus := sw.Header().Get(cache.Header); cacheStatus != "" {
+			m.cacheResults.WithLabelValues(cacheStatus).Inc()
+		}
+	})
+}
+
+// sniffWriter records the status code of a response and the beginning of its
+// body if it is an error.
+type sniffWriter struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (w *sniffWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sniffWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if w.code >= http.StatusBadRequest && w.body.Len() < maxSniffLength {
+		w.body.Write(b[:min(len(b), maxSniffLength-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sniffWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+func (w *sniffWriter) errorCode() string {
+	if w.status() < http.StatusBadRequest {
+		return codeOK
+	}
+	var errorResponse types.ErrorResponse
+	if err := json.Unmarshal(w.body.Bytes(), &errorResponse); err != nil || errorResponse.Code == "" {
+		return "UNKNOWN"
+	}
+	return string(errorResponse.Code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *sniffWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/cache"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/utils"
+)
+
+type fakeClient struct {
+	haiku types.Haiku
+	err   error
+}
+
+func (c *fakeClient) Call(_ context.Context, _, _ string) (types.Haiku, error) {
+	return c.haiku, c.err
+}
+
+func TestMiddleware(t *testing.T) {
+	cases := []struct {
+		name        string
+		status      int
+		body        string
+		cacheStatus types.CacheStatus
+		wantCode    string
+	}{
+		{name: "success", status: http.StatusOK, body: `{"haiku":"EXAMPLE_HAIKU"}`, cacheStatus: types.CacheHit, wantCode: "OK"},
+		{name: "error response", status: http.StatusBadRequest, body: `{"code":"INVALID_REQUEST","details":"EXAMPLE_DETAILS"}`, wantCode: "INVALID_REQUEST"},
+		{name: "rate limited", status: http.StatusTooManyRequests, body: `{"code":"RATE_LIMITED","details":"EXAMPLE_DETAILS"}`, wantCode: "RATE_LIMITED"},
+		{name: "no error code", status: http.StatusBadGateway, body: "EXAMPLE_BODY", wantCode: "UNKNOWN"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := New(prometheus.NewRegistry())
+			handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.cacheStatus != "" {
+					w.Header().Set(cache.Header, string(c.cacheStatus))
+				}
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+			if rec.Body.String() != c.body {
+				t.Errorf("Expected body %q to pass through, got %q", c.body, rec.Body.String())
+			}
+
+			if got := testutil.ToFloat64(m.requests.WithLabelValues(strconv.Itoa(c.status), c.wantCode)); got != 1 {
+				t.Errorf("Expected 1 request with status %d and code %s, got %v", c.status, c.wantCode, got)
+			}
+
+			wantRateLimited := 0.0
+			if c.wantCode == string(types.ErrRateLimited) {
+				wantRateLimited = 1
+			}
+			if got := testutil.ToFloat64(m.rateLimited); got != wantRateLimited {
+				t.Errorf("Expected %v rate-limited requests, got %v", wantRateLimited, got)
+			}
+
+			wantCacheResults := 0
+			if c.cacheStatus != "" {
+				wantCacheResults = 1
+			}
+			if got := testutil.CollectAndCount(m.cacheResults); got != wantCacheResults {
+				t.Errorf("Expected %d cache results, got %d", wantCacheResults, got)
+			}
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	cases := []struct {
+		name        string
+		client      *fakeClient
+		model       string
+		wantModel   string
+		wantOutcome string
+	}{
+		{
+			name:        "success",
+			client:      &fakeClient{haiku: types.Haiku{Meta: &types.Meta{Model: "gpt-4o-2024-08-06", Usage: types.Usage{PromptTokens: 1000}}}},
+			wantModel:   "gpt-4o-2024-08-06",
+			wantOutcome: "success",
+		},
+		{
+			name:        "rejected",
+			client:      &fakeClient{err: utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "%s", "EXAMPLE_POLICY_VIOLATION")},
+			model:       "gpt-4o-mini",
+			wantModel:   "gpt-4o-mini",
+			wantOutcome: "rejected",
+		},
+		{
+			name:        "error",
+			client:      &fakeClient{err: utils.NewInternalErr("%s", "EXAMPLE_ERROR")},
+			wantModel:   "default",
+			wantOutcome: "error",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := New(prometheus.NewRegistry())
+			client := NewClient(c.client, m)
+			start := time.Unix(0, 0)
+			calls := 0
+			client.now = func() time.Time {
+				calls++
+				return start.Add(time.Duration(calls) * time.Second)
+			}
+
+			ctx := types.WithCallInfo(context.Background(), types.CallInfo{Model: c.model})
+			client.Call(ctx, "EXAMPLE_PROMPT", "AAAA")
+
+			if got := testutil.CollectAndCount(m.upstreamDuration); got != 1 {
+				t.Fatalf("Expected 1 upstream series, got %d", got)
+			}
+			observer, err := m.upstreamDuration.GetMetricWithLabelValues(c.wantModel, c.wantOutcome)
+			if err != nil {
+				t.Fatalf("Failed to get upstream series: %v", err)
+			}
+			if got := sampleSum(t, observer.(prometheus.Histogram)); got != 1 {
+				t.Errorf("Expected 1 second upstream latency for %s/%s, got %v", c.wantModel, c.wantOutcome, got)
+			}
+			if got := sampleSum(t, m.imageSize); got != 3 {
+				t.Errorf("Expected an image size of 3 bytes, got %v", got)
+			}
+		})
+	}
+}
+
+func sampleSum(t *testing.T, h prometheus.Histogram) float64 {
+	t.Helper()
+
+	ch := make(chan prometheus.Metric, 1)
+	h.Collect(ch)
+
+	var out dto.Metric
+	if err := (<-ch).Write(&out); err != nil {
+		t.Fatalf("Failed to read histogram: %v", err)
+	}
+	return out.GetHistogram().GetSampleSum()
+}
@@ -4,8 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/logging"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/tracing"
 	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
 	"github.com/rd-martin-zoeller/img2haiku-backend/internal/utils"
 )
@@ -13,19 +20,58 @@ import (
 type OpenAiClient struct {
 	ApiKey string
 	Client *http.Client
+	// Prices estimates the cost of each call. DefaultPrices is used if nil.
+	Prices PriceTable
+	// APIURL, Model and MaxTokens fall back to their defaults if empty.
+	APIURL    string
+	Model     string
+	MaxTokens int
+	// Temperature falls back to DefaultTemperature if nil.
+	Temperature *float32
 }
 
-const apiURL = "https://api.openai.com/v1/chat/completions"
+const DefaultAPIURL = "https://api.openai.com/v1/chat/completions"
+
+// maxErrorBodyLength bounds how much of an error response ends up in the
+// logs. Clients never see it.
+const maxErrorBodyLength = 1024
 
-func (c *OpenAiClient) Call(ctx context.Context, prompt, base64Image string) (types.Haiku, error) {
-	var haiku types.Haiku
+func (c *OpenAiClient) Call(ctx context.Context, prompt, base64Image string) (haiku types.Haiku, err error) {
 	reqObj := buildRequest(prompt, base64Image)
+	if c.Model != "" {
+		reqObj.Model = c.Model
+	}
+	if c.MaxTokens != 0 {
+		reqObj.MaxTokens = c.MaxTokens
+	}
+	if c.Temperature != nil {
+		reqObj.Temperature = *c.Temperature
+	}
+	if info, ok := types.CallInfoFromContext(ctx); ok {
+		if info.Model != "" {
+			reqObj.Model = info.Model
+		}
+		if info.Detail != "" {
+			reqObj.Messages[0].Content[1].ImageURL.Detail = string(info.Detail)
+		}
+	}
+
+	ctx, span := tracing.Start(ctx, "openai.chat_completion", trace.WithAttributes(
+		attribute.String("openai.model", reqObj.Model),
+		attribute.Int("openai.image_base64_bytes", len(base64Image)),
+	))
+	defer func() { tracing.End(span, err) }()
 
 	bodyBytes, err := json.Marshal(reqObj)
 	if err != nil {
 		return haiku, utils.NewInternalErr("Failed to encode request body: %s", err.Error())
 	}
 
+	apiURL := c.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return haiku, utils.NewInternalErr("Failed to create request: %s", err.Error())
@@ -33,17 +79,61 @@ func (c *OpenAiClient) Call(ctx context.Context, prompt, base64Image string) (ty
 
 	req.Header.Set("Authorization", "Bearer "+c.ApiKey)
 	req.Header.Set("Content-Type", "application/json")
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set("X-Client-Request-Id", id)
+	}
 
 	resp, err := c.Client.Do(req)
 	if err != nil {
-		return haiku, utils.NewInternalErr("Failed to call OpenAI API: %+v", err)
+		return haiku, utils.NewInternalErr("Failed to call OpenAI API: %v", err)
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return haiku, utils.NewInternalErr("OpenAI API returned an error: %+v", resp)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLength))
+		slog.ErrorContext(ctx, "OpenAI API returned an error", "status", resp.StatusCode, "body", string(body))
+		return haiku, utils.NewInternalErr("OpenAI API returned status %d", resp.StatusCode)
+	}
+
+	_, parseSpan := tracing.Start(ctx, "openai.parse_response")
+	haiku, err = handleResponseBody(ctx, resp)
+	tracing.End(parseSpan, err)
+	c.recordUsage(ctx, reqObj.Model, &haiku)
+	return haiku, err
+}
+
+// recordUsage estimates the cost of a call and logs its token usage.
+func (c *OpenAiClient) recordUsage(ctx context.Context, requestedModel string, haiku *types.Haiku) {
+	if haiku.Meta == nil {
+		return
+	}
+
+	prices := c.Prices
+	if prices == nil {
+		prices = DefaultPrices
+	}
+
+	meta := haiku.Meta
+	if meta.Model == "" {
+		meta.Model = requestedModel
+	}
+
+	cost, ok := prices.Cost(meta.Model, meta.Usage)
+	if !ok {
+		cost, ok = prices.Cost(requestedModel, meta.Usage)
+	}
+	if !ok {
+		slog.WarnContext(ctx, "No price configured for model", "model", meta.Model)
 	}
+	meta.EstimatedCostUSD = cost
 
-	return handleResponseBody(resp)
+	slog.InfoContext(ctx, "OpenAI usage",
+		"model", meta.Model,
+		"promptTokens", meta.Usage.PromptTokens,
+		"completionTokens", meta.Usage.CompletionTokens,
+		"imageTokens", meta.Usage.ImageTokens,
+		"totalTokens", meta.Usage.TotalTokens,
+		"estimatedCostUsd", meta.EstimatedCostUSD,
+	)
 }
@@ -0,0 +1,130 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+const exampleResponse = `{
+	"model": "EXAMPLE_MODEL",
+	"choices": [{"message": {"content": "{\"title\":\"EXAMPLE_TITLE\",\"haiku\":\"EXAMPLE_HAIKU\",\"description\":\"EXAMPLE_DESCRIPTION\",\"altText\":\"EXAMPLE_ALT_TEXT\"}"}}],
+	"usage": {"prompt_tokens": 1000, "completion_tokens": 100, "total_tokens": 1100}
+}`
+
+func TestCall(t *testing.T) {
+	temperature := float32(0)
+	cases := []struct {
+		name            string
+		client          OpenAiClient
+		info            *types.CallInfo
+		wantModel       string
+		wantMaxTokens   int
+		wantTemperature float32
+		wantDetail      string
+	}{
+		{
+			name:            "defaults",
+			wantModel:       DefaultModel,
+			wantMaxTokens:   DefaultMaxTokens,
+			wantTemperature: DefaultTemperature,
+		},
+		{
+			name:            "configured",
+			client:          OpenAiClient{Model: "EXAMPLE_MODEL", MaxTokens: 500, Temperature: &temperature},
+			wantModel:       "EXAMPLE_MODEL",
+			wantMaxTokens:   500,
+			wantTemperature: 0,
+		},
+		{
+			name:            "fallback model",
+			client:          OpenAiClient{Model: "EXAMPLE_MODEL"},
+			info:            &types.CallInfo{Model: "EXAMPLE_FALLBACK_MODEL"},
+			wantModel:       "EXAMPLE_FALLBACK_MODEL",
+			wantMaxTokens:   DefaultMaxTokens,
+			wantTemperature: DefaultTemperature,
+		},
+		{
+			name:            "high detail",
+			info:            &types.CallInfo{Detail: types.DetailHigh},
+			wantModel:       DefaultModel,
+			wantMaxTokens:   DefaultMaxTokens,
+			wantTemperature: DefaultTemperature,
+			wantDetail:      "high",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if auth := r.Header.Get("Authorization"); auth != "Bearer EXAMPLE_API_KEY" {
+					t.Errorf("Expected the API key in the Authorization header, got %q", auth)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("Failed to decode request: %v", err)
+				}
+				w.Write([]byte(exampleResponse))
+			}))
+			defer server.Close()
+
+			client := c.client
+			client.ApiKey = "EXAMPLE_API_KEY"
+			client.Client = server.Client()
+			client.APIURL = server.URL
+
+			ctx := context.Background()
+			if c.info != nil {
+				ctx = types.WithCallInfo(ctx, *c.info)
+			}
+
+			haiku, err := client.Call(ctx, "EXAMPLE_PROMPT", "EXAMPLE_BASE64_IMAGE")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if haiku.Haiku != "EXAMPLE_HAIKU" {
+				t.Errorf("Expected haiku EXAMPLE_HAIKU, got %q", haiku.Haiku)
+			}
+
+			if got.Model != c.wantModel {
+				t.Errorf("Expected model %q, got %q", c.wantModel, got.Model)
+			}
+			if got.MaxTokens != c.wantMaxTokens {
+				t.Errorf("Expected max tokens %d, got %d", c.wantMaxTokens, got.MaxTokens)
+			}
+			if got.Temperature != c.wantTemperature {
+				t.Errorf("Expected temperature %v, got %v", c.wantTemperature, got.Temperature)
+			}
+			if detail := got.Messages[0].Content[1].ImageURL.Detail; detail != c.wantDetail {
+				t.Errorf("Expected image detail %q, got %q", c.wantDetail, detail)
+			}
+		})
+	}
+}
+
+func TestCallUpstreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "EXAMPLE_UPSTREAM_MESSAGE"}}`))
+	}))
+	defer server.Close()
+
+	client := OpenAiClient{ApiKey: "EXAMPLE_API_KEY", Client: server.Client(), APIURL: server.URL}
+	_, err := client.Call(context.Background(), "EXAMPLE_PROMPT", "EXAMPLE_BASE64_IMAGE")
+
+	var composeErr *types.ComposeError
+	if !errors.As(err, &composeErr) || composeErr.Code != types.ErrInternalError {
+		t.Fatalf("Expected an internal error, got %v", err)
+	}
+	if strings.Contains(composeErr.Details, "EXAMPLE_UPSTREAM_MESSAGE") {
+		t.Errorf("Expected the upstream body not to reach the client, got %q", composeErr.Details)
+	}
+}
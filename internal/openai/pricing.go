@@ -0,0 +1,29 @@
+package openai
+
+import "github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+
+// Price is the price of a model in US dollars per million tokens.
+type Price struct {
+	InputPerMillion  float64 `json:"inputPerMillion" yaml:"inputPerMillion"`
+	OutputPerMillion float64 `json:"outputPerMillion" yaml:"outputPerMillion"`
+}
+
+// PriceTable maps model names, as reported by the API, to their price.
+type PriceTable map[string]Price
+
+var DefaultPrices = PriceTable{
+	"gpt-4o":            {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+	"gpt-4o-2024-08-06": {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+	"gpt-4o-mini":       {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+}
+
+// Cost estimates the cost of usage in US dollars. Image tokens are part of
+// the prompt tokens and are billed as such. The result is false for models
+// missing from the table.
+func (t PriceTable) Cost(model string, usage types.Usage) (float64, bool) {
+	price, ok := t[model]
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*price.InputPerMillion + float64(usage.CompletionTokens)*price.OutputPerMillion) / 1_000_000, true
+}
@@ -0,0 +1,27 @@
+package openai
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+func TestPriceTableCost(t *testing.T) {
+	prices := PriceTable{
+		"EXAMPLE_MODEL": {InputPerMillion: 2, OutputPerMillion: 10},
+	}
+	usage := types.Usage{PromptTokens: 1000, CompletionTokens: 100, ImageTokens: 765, TotalTokens: 1100}
+
+	cost, ok := prices.Cost("EXAMPLE_MODEL", usage)
+	if !ok {
+		t.Fatalf("Expected price for EXAMPLE_MODEL")
+	}
+	if want := 0.003; math.Abs(cost-want) > 1e-12 {
+		t.Errorf("Expected cost %v, got %v", want, cost)
+	}
+
+	if _, ok := prices.Cost("UNKNOWN_MODEL", usage); ok {
+		t.Errorf("Expected no price for UNKNOWN_MODEL")
+	}
+}
@@ -1,5 +1,13 @@
 package openai
 
+const (
+	DefaultModel = "gpt-4o-2024-08-06"
+	// DefaultMaxTokens leaves room for the title and alt text next to the
+	// haiku and its description.
+	DefaultMaxTokens   = 350
+	DefaultTemperature = 0.7
+)
+
 type request struct {
 	Model       string        `json:"model"`
 	Messages    []chatMessage `json:"messages"`
@@ -19,12 +27,13 @@ type messageContent struct {
 }
 
 type imageUrl struct {
-	URL string `json:"url"`
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
 }
 
 func buildRequest(prompt, base64Image string) *request {
 	return &request{
-		Model: "gpt-4o-2024-08-06",
+		Model: DefaultModel,
 		Messages: []chatMessage{
 			{
 				Role: "user",
@@ -42,7 +51,7 @@ func buildRequest(prompt, base64Image string) *request {
 				},
 			},
 		},
-		MaxTokens:   150,
-		Temperature: 0.7,
+		MaxTokens:   DefaultMaxTokens,
+		Temperature: DefaultTemperature,
 	}
 }
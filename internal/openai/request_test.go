@@ -16,7 +16,7 @@ func TestBuildRequest(t *testing.T) {
 
 	json := string(bodyBytes)
 
-	want := `{"model":"gpt-4o-2024-08-06","messages":[{"role":"user","content":[{"type":"text","text":"EXAMPLE_PROMPT"},{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,EXAMPLE_BASE64_IMAGE"}}]}],"max_tokens":200,"temperature":1}`
+	want := `{"model":"gpt-4o-2024-08-06","messages":[{"role":"user","content":[{"type":"text","text":"EXAMPLE_PROMPT"},{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,EXAMPLE_BASE64_IMAGE"}}]}],"max_tokens":350,"temperature":0.7}`
 
 	if strings.Compare(json, want) != 0 {
 		t.Errorf("Expected JSON: %s, got: %s", want, json)
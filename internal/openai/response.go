@@ -1,7 +1,9 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -10,7 +12,20 @@ import (
 )
 
 type response struct {
+	Model   string   `json:"model"`
 	Choices []choice `json:"choices"`
+	Usage   usage    `json:"usage"`
+}
+
+type usage struct {
+	PromptTokens        int                 `json:"prompt_tokens"`
+	CompletionTokens    int                 `json:"completion_tokens"`
+	TotalTokens         int                 `json:"total_tokens"`
+	PromptTokensDetails promptTokensDetails `json:"prompt_tokens_details"`
+}
+
+type promptTokensDetails struct {
+	ImageTokens int `json:"image_tokens"`
 }
 
 type choice struct {
@@ -22,12 +37,17 @@ type message struct {
 }
 
 type haikuAnswer struct {
+	Title       string `json:"title"`
 	Haiku       string `json:"haiku"`
 	Description string `json:"description"`
+	AltText     string `json:"altText"`
+	Kigo        string `json:"kigo"`
 	Error       string `json:"error"`
 }
 
-func handleResponseBody(resp *http.Response) (types.Haiku, error) {
+// handleResponseBody parses the answer of the model. The answer itself only
+// ends up in the logs, never in the error details that reach the client.
+func handleResponseBody(ctx context.Context, resp *http.Response) (types.Haiku, error) {
 	var haiku types.Haiku
 
 	var openAiResponse response
@@ -35,6 +55,17 @@ func handleResponseBody(resp *http.Response) (types.Haiku, error) {
 		return haiku, utils.NewInternalErr("Failed to decode response body: %s", err.Error())
 	}
 
+	// The tokens are spent even if the answer turns out to be unusable.
+	haiku.Meta = &types.Meta{
+		Model: openAiResponse.Model,
+		Usage: types.Usage{
+			PromptTokens:     openAiResponse.Usage.PromptTokens,
+			CompletionTokens: openAiResponse.Usage.CompletionTokens,
+			ImageTokens:      openAiResponse.Usage.PromptTokensDetails.ImageTokens,
+			TotalTokens:      openAiResponse.Usage.TotalTokens,
+		},
+	}
+
 	if len(openAiResponse.Choices) == 0 {
 		return haiku, utils.NewInternalErr("%s", "No choices found in response")
 	}
@@ -43,19 +74,24 @@ func handleResponseBody(resp *http.Response) (types.Haiku, error) {
 
 	var haikuResponse haikuAnswer
 	if err := json.Unmarshal([]byte(answer), &haikuResponse); err != nil {
-		return haiku, utils.NewInternalErr("Failed to unmarshal answer JSON: %s\n%s", err.Error(), answer)
+		slog.ErrorContext(ctx, "Failed to unmarshal the model answer", "answer", answer, "error", err)
+		return haiku, utils.NewInternalErr("Failed to unmarshal answer JSON: %s", err.Error())
 	}
 
 	if haikuResponse.Error != "" {
 		return haiku, utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "%s", haikuResponse.Error)
 	}
 
-	if haikuResponse.Haiku == "" || haikuResponse.Description == "" {
-		return haiku, utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "Invalid response format: haiku or description not found %s", answer)
+	if haikuResponse.Haiku == "" || haikuResponse.Description == "" || haikuResponse.Title == "" || haikuResponse.AltText == "" {
+		slog.ErrorContext(ctx, "Model answer is incomplete", "answer", answer)
+		return haiku, utils.NewErr(http.StatusBadRequest, types.ErrInvalidRequest, "%s", "Invalid response format: haiku, description, title or alt text not found")
 	}
 
+	haiku.Title = haikuResponse.Title
 	haiku.Haiku = sanitizeHaiku(haikuResponse.Haiku)
 	haiku.Description = haikuResponse.Description
+	haiku.AltText = haikuResponse.AltText
+	haiku.Kigo = haikuResponse.Kigo
 	return haiku, nil
 }
 
@@ -2,6 +2,7 @@ package openai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -16,6 +17,7 @@ func TestHandleResponseBody(t *testing.T) {
 		name             string
 		responseBody     response
 		wantHaiku        string
+		wantUsage        *types.Usage
 		wantErrorMessage string
 	}{
 		{
@@ -39,7 +41,7 @@ func TestHandleResponseBody(t *testing.T) {
 					},
 				},
 			},
-			wantErrorMessage: "Failed to unmarshal answer JSON: invalid character 'E' looking for beginning of value\nEXAMPLE_HAIKU",
+			wantErrorMessage: "Failed to unmarshal answer JSON: invalid character 'E' looking for beginning of value",
 		},
 		{
 			name: "error JSON",
@@ -54,6 +56,21 @@ func TestHandleResponseBody(t *testing.T) {
 			},
 			wantErrorMessage: "EXAMPLE_ERROR",
 		},
+		{
+			name: "usage is reported for errors",
+			responseBody: response{
+				Choices: []choice{
+					{
+						Message: message{
+							Content: `{"error":"EXAMPLE_ERROR"}`,
+						},
+					},
+				},
+				Usage: usage{PromptTokens: 900, CompletionTokens: 20, TotalTokens: 920},
+			},
+			wantUsage:        &types.Usage{PromptTokens: 900, CompletionTokens: 20, TotalTokens: 920},
+			wantErrorMessage: "EXAMPLE_ERROR",
+		},
 		{
 			name: "no relevant JSON field",
 			responseBody: response{
@@ -65,7 +82,7 @@ func TestHandleResponseBody(t *testing.T) {
 					},
 				},
 			},
-			wantErrorMessage: `Invalid response format: haiku or description not found {"some_other_field":"SOME_OTHER_FIELD"}`,
+			wantErrorMessage: "Invalid response format: haiku, description, title or alt text not found",
 		},
 		{
 			name: "description missing in JSON",
@@ -78,7 +95,7 @@ func TestHandleResponseBody(t *testing.T) {
 					},
 				},
 			},
-			wantErrorMessage: `Invalid response format: haiku or description not found {"haiku":"EXAMPLE_HAIKU"}`,
+			wantErrorMessage: "Invalid response format: haiku, description, title or alt text not found",
 		},
 		{
 			name: "haiku missing in JSON",
@@ -91,7 +108,33 @@ func TestHandleResponseBody(t *testing.T) {
 					},
 				},
 			},
-			wantErrorMessage: `Invalid response format: haiku or description not found {"description":"EXAMPLE_DESCRIPTION"}`,
+			wantErrorMessage: "Invalid response format: haiku, description, title or alt text not found",
+		},
+		{
+			name: "title missing in JSON",
+			responseBody: response{
+				Choices: []choice{
+					{
+						Message: message{
+							Content: `{"description":"EXAMPLE_DESCRIPTION","altText":"EXAMPLE_ALT_TEXT","haiku":"EXAMPLE_HAIKU"}`,
+						},
+					},
+				},
+			},
+			wantErrorMessage: "Invalid response format: haiku, description, title or alt text not found",
+		},
+		{
+			name: "alt text missing in JSON",
+			responseBody: response{
+				Choices: []choice{
+					{
+						Message: message{
+							Content: `{"title":"EXAMPLE_TITLE","description":"EXAMPLE_DESCRIPTION","haiku":"EXAMPLE_HAIKU"}`,
+						},
+					},
+				},
+			},
+			wantErrorMessage: "Invalid response format: haiku, description, title or alt text not found",
 		},
 		{
 			name: "valid JSON",
@@ -99,12 +142,33 @@ func TestHandleResponseBody(t *testing.T) {
 				Choices: []choice{
 					{
 						Message: message{
-							Content: `{"description":"EXAMPLE_DESCRIPTION","haiku":"EXAMPLE_HAIKU"}`,
+							Content: `{"title":"EXAMPLE_TITLE","description":"EXAMPLE_DESCRIPTION","altText":"EXAMPLE_ALT_TEXT","haiku":"EXAMPLE_HAIKU"}`,
+						},
+					},
+				},
+			},
+			wantHaiku: "EXAMPLE_HAIKU",
+		},
+		{
+			name: "valid JSON with usage",
+			responseBody: response{
+				Model: "gpt-4o-2024-08-06",
+				Choices: []choice{
+					{
+						Message: message{
+							Content: `{"title":"EXAMPLE_TITLE","description":"EXAMPLE_DESCRIPTION","altText":"EXAMPLE_ALT_TEXT","haiku":"EXAMPLE_HAIKU"}`,
 						},
 					},
 				},
+				Usage: usage{
+					PromptTokens:        1000,
+					CompletionTokens:    100,
+					TotalTokens:         1100,
+					PromptTokensDetails: promptTokensDetails{ImageTokens: 765},
+				},
 			},
 			wantHaiku: "EXAMPLE_HAIKU",
+			wantUsage: &types.Usage{PromptTokens: 1000, CompletionTokens: 100, ImageTokens: 765, TotalTokens: 1100},
 		},
 		{
 			name: "sanitizes valid JSON",
@@ -112,7 +176,7 @@ func TestHandleResponseBody(t *testing.T) {
 				Choices: []choice{
 					{
 						Message: message{
-							Content: `{"description":"EXAMPLE_DESCRIPTION","haiku":"EXAMPLE_HAIKU\\nEXAMPLE_HAIKU"}`,
+							Content: `{"title":"EXAMPLE_TITLE","description":"EXAMPLE_DESCRIPTION","altText":"EXAMPLE_ALT_TEXT","haiku":"EXAMPLE_HAIKU\\nEXAMPLE_HAIKU"}`,
 						},
 					},
 				},
@@ -133,7 +197,7 @@ func TestHandleResponseBody(t *testing.T) {
 				Body:       io.NopCloser(bytes.NewBuffer(bodyBytes)),
 			}
 
-			haiku, err := handleResponseBody(&httpResponse)
+			haiku, err := handleResponseBody(context.Background(), &httpResponse)
 			if c.wantErrorMessage != "" {
 				if err == nil {
 					t.Fatalf("Expected error, got nil")
@@ -145,6 +209,15 @@ func TestHandleResponseBody(t *testing.T) {
 				}
 			}
 
+			if c.wantUsage != nil {
+				if haiku.Meta == nil {
+					t.Fatalf("Expected usage %+v, got no meta", *c.wantUsage)
+				}
+				if haiku.Meta.Usage != *c.wantUsage {
+					t.Errorf("Expected usage %+v, got %+v", *c.wantUsage, haiku.Meta.Usage)
+				}
+			}
+
 			if c.wantHaiku != "" {
 				if haiku.Haiku != c.wantHaiku {
 					t.Errorf("Expected haiku %s, got %s", c.wantHaiku, haiku.Haiku)
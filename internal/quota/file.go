@@ -0,0 +1,138 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// saveInterval bounds how long changed counters stay unsaved, so that busy
+// instances do not rewrite the file for every haiku.
+const saveInterval = 5 * time.Second
+
+// FileStore is a Store that persists its counters in a JSON file, so that they
+// survive restarts of a single instance. Changes are saved within
+// saveInterval and on Close; a crash loses the changes since the last save.
+// It is not meant to be shared between instances.
+type FileStore struct {
+	path string
+
+	mu        sync.Mutex
+	counters  map[string]counter
+	saveTimer *time.Timer
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewFileStore loads the counters from path. A missing file starts with no
+// counters.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, counters: make(map[string]counter), now: time.Now}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &s.counters); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Get(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return count(s.counters, key, s.now()), nil
+}
+
+func (s *FileStore) Reserve(_ context.Context, key string, limit int64, expiresAt time.Time) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	sweep(s.counters, &s.lastSweep, now)
+	n, ok := reserve(s.counters, key, limit, expiresAt, now)
+	if ok {
+		s.scheduleSave()
+	}
+	return n, ok, nil
+}
+
+func (s *FileStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if release(s.counters, key, s.now()) {
+		s.scheduleSave()
+	}
+	return nil
+}
+
+// Close saves pending changes.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.saveTimer == nil {
+		return nil
+	}
+	s.saveTimer.Stop()
+	s.saveTimer = nil
+	return s.save()
+}
+
+// scheduleSave saves the counters after saveInterval unless a save is
+// already pending. s.mu must be held.
+func (s *FileStore) scheduleSave() {
+	if s.saveTimer != nil {
+		return
+	}
+	s.saveTimer = time.AfterFunc(saveInterval, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.saveTimer == nil {
+			// Close saved already.
+			return
+		}
+		s.saveTimer = nil
+		if err := s.save(); err != nil {
+			slog.Error("Failed to save quota counters", "path", s.path, "error", err)
+		}
+	})
+}
+
+// save writes the counters to a temporary file first, so that a crash never
+// leaves a truncated file behind.
+func (s *FileStore) save() error {
+	data, err := json.Marshal(s.counters)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
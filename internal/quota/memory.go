@@ -0,0 +1,101 @@
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired counters are dropped.
+const sweepInterval = time.Minute
+
+type counter struct {
+	Count     int64     `json:"count"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// MemoryStore is an in-process Store. Counters are lost on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]counter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]counter), now: time.Now}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return count(s.counters, key, s.now()), nil
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, key string, limit int64, expiresAt time.Time) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	sweep(s.counters, &s.lastSweep, now)
+	n, ok := reserve(s.counters, key, limit, expiresAt, now)
+	return n, ok, nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	release(s.counters, key, s.now())
+	return nil
+}
+
+func count(counters map[string]counter, key string, now time.Time) int64 {
+	c, ok := counters[key]
+	if !ok || !now.Before(c.ExpiresAt) {
+		return 0
+	}
+	return c.Count
+}
+
+// sweep drops expired counters. It runs at most once per sweepInterval after
+// lastSweep to keep Reserve cheap.
+func sweep(counters map[string]counter, lastSweep *time.Time, now time.Time) {
+	if now.Sub(*lastSweep) < sweepInterval {
+		return
+	}
+	*lastSweep = now
+
+	for k, c := range counters {
+		if !now.Before(c.ExpiresAt) {
+			delete(counters, k)
+		}
+	}
+}
+
+func reserve(counters map[string]counter, key string, limit int64, expiresAt, now time.Time) (int64, bool) {
+	c := counters[key]
+	if !now.Before(c.ExpiresAt) {
+		// The counter expired but was not swept yet.
+		c = counter{}
+	}
+	if c.Count >= limit {
+		return c.Count, false
+	}
+	c.Count++
+	c.ExpiresAt = expiresAt
+	counters[key] = c
+	return c.Count, true
+}
+
+// release reports whether a counter was decremented.
+func release(counters map[string]counter, key string, now time.Time) bool {
+	c, ok := counters[key]
+	if !ok || !now.Before(c.ExpiresAt) || c.Count == 0 {
+		return false
+	}
+	c.Count--
+	counters[key] = c
+	return true
+}
@@ -0,0 +1,173 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	RemainingHeader = "X-Quota-Remaining"
+	ResetHeader     = "X-Quota-Reset"
+
+	// DefaultPlan applies to subjects whose token names no known plan.
+	DefaultPlan = "free"
+)
+
+// Plan limits the haikus a subject may compose per UTC day and month. A limit
+// of zero means unlimited.
+type Plan struct {
+	Daily   int
+	Monthly int
+}
+
+var DefaultPlans = map[string]Plan{
+	"free":    {Daily: 20, Monthly: 300},
+	"premium": {Daily: 200, Monthly: 3000},
+}
+
+// Store keeps quota counters. Implementations must be safe for concurrent
+// use.
+type Store interface {
+	// Get returns the current count of key, or zero if it does not exist.
+	Get(ctx context.Context, key string) (int64, error)
+	// Reserve adds one to key unless it has reached limit, in one atomic
+	// step, and returns the count. The counter is dropped at expiresAt.
+	Reserve(ctx context.Context, key string, limit int64, expiresAt time.Time) (count int64, reserved bool, err error)
+	// Release takes back one reservation of key.
+	Release(ctx context.Context, key string) error
+}
+
+// Result describes the remaining quota of a subject.
+type Result struct {
+	// Limited is false for plans without any limit.
+	Limited bool
+	// Allowed reports whether the subject may compose another haiku.
+	Allowed   bool
+	Remaining int
+	// Reset is when the period that limits the subject the most starts over.
+	Reset time.Time
+}
+
+type Quota struct {
+	store Store
+	plans map[string]Plan
+	now   func() time.Time
+}
+
+func New(store Store, plans map[string]Plan) *Quota {
+	return &Quota{store: store, plans: plans, now: time.Now}
+}
+
+type period struct {
+	key   string
+	limit int
+	reset time.Time
+}
+
+func (q *Quota) periods(subject, planName string) []period {
+	plan, ok := q.plans[planName]
+	if !ok {
+		plan = q.plans[DefaultPlan]
+	}
+
+	now := q.now().UTC()
+	year, month, day := now.Date()
+
+	var periods []period
+	if plan.Daily > 0 {
+		periods = append(periods, period{
+			key:   fmt.Sprintf("%s:day:%04d-%02d-%02d", subject, year, month, day),
+			limit: plan.Daily,
+			reset: time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	if plan.Monthly > 0 {
+		periods = append(periods, period{
+			key:   fmt.Sprintf("%s:month:%04d-%02d", subject, year, month),
+			limit: plan.Monthly,
+			reset: time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return periods
+}
+
+// Check reports whether subject may compose another haiku without using up
+// any quota.
+func (q *Quota) Check(ctx context.Context, subject, plan string) (Result, error) {
+	result := Result{Allowed: true}
+
+	for _, p := range q.periods(subject, plan) {
+		used, err := q.store.Get(ctx, p.key)
+		if err != nil {
+			return result, err
+		}
+		result.add(p, used)
+	}
+
+	return result, nil
+}
+
+// Reserve uses up one haiku of the subject's quota if there is one left in
+// every period. Checking and counting are one atomic step, so concurrent
+// requests cannot exceed the quota. Result.Allowed reports whether the haiku
+// was reserved.
+func (q *Quota) Reserve(ctx context.Context, subject, plan string) (Result, error) {
+	result := Result{Allowed: true}
+
+	var reserved []period
+	for _, p := range q.periods(subject, plan) {
+		used, ok, err := q.store.Reserve(ctx, p.key, int64(p.limit), p.reset)
+		if err != nil {
+			q.release(ctx, reserved)
+			return Result{}, err
+		}
+		result.add(p, used)
+		if !ok {
+			// The reservations of the other periods are taken back, and
+			// this period limits the subject.
+			q.release(ctx, reserved)
+			result.Allowed = false
+			result.Remaining = 0
+			result.Reset = p.reset
+			return result, nil
+		}
+		reserved = append(reserved, p)
+	}
+
+	// The last haiku of a period may be reserved, which add counts as
+	// not allowed.
+	result.Allowed = true
+	return result, nil
+}
+
+// Release gives back a haiku reserved with Reserve that was not composed,
+// and returns the quota that is left.
+func (q *Quota) Release(ctx context.Context, subject, plan string) (Result, error) {
+	if err := q.release(ctx, q.periods(subject, plan)); err != nil {
+		return Result{}, err
+	}
+	return q.Check(ctx, subject, plan)
+}
+
+func (q *Quota) release(ctx context.Context, periods []period) error {
+	var errs []error
+	for _, p := range periods {
+		errs = append(errs, q.store.Release(ctx, p.key))
+	}
+	return errors.Join(errs...)
+}
+
+// add accounts for a period in which used haikus were composed.
+func (r *Result) add(p period, used int64) {
+	remaining := max(p.limit-int(used), 0)
+	if !r.Limited || remaining < r.Remaining {
+		r.Remaining = remaining
+		r.Reset = p.reset
+	}
+	r.Limited = true
+	if remaining == 0 {
+		r.Allowed = false
+	}
+}
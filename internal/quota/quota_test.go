@@ -0,0 +1,202 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var testPlans = map[string]Plan{
+	"free":      {Daily: 2, Monthly: 3},
+	"unlimited": {},
+}
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 30, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	quota := New(store, testPlans)
+	quota.now = func() time.Time { return now }
+
+	dayReset := time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)
+	monthReset := time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name          string
+		plan          string
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantReset     time.Time
+	}{
+		{name: "first haiku", plan: "free", wantAllowed: true, wantRemaining: 1, wantReset: dayReset},
+		{name: "last haiku of the day", plan: "free", wantAllowed: true, wantRemaining: 0, wantReset: dayReset},
+		{name: "daily quota is used up", plan: "free", wantAllowed: false, wantRemaining: 0, wantReset: dayReset},
+		{name: "next day has a new daily quota", plan: "free", advance: 24 * time.Hour, wantAllowed: true, wantRemaining: 0, wantReset: monthReset},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		check, err := quota.Check(ctx, "alice", step.plan)
+		if err != nil || check.Allowed != step.wantAllowed {
+			t.Fatalf("%s: expected check to allow %v, got %+v, err=%v", step.name, step.wantAllowed, check, err)
+		}
+
+		result, err := quota.Reserve(ctx, "alice", step.plan)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", step.name, err)
+		}
+		if result.Allowed != step.wantAllowed {
+			t.Errorf("%s: expected allowed to be %v, got %v", step.name, step.wantAllowed, result.Allowed)
+		}
+		if result.Remaining != step.wantRemaining {
+			t.Errorf("%s: expected %d remaining, got %d", step.name, step.wantRemaining, result.Remaining)
+		}
+		if !result.Reset.Equal(step.wantReset) {
+			t.Errorf("%s: expected reset at %v, got %v", step.name, step.wantReset, result.Reset)
+		}
+	}
+
+	if result, _ := quota.Check(ctx, "alice", "free"); result.Allowed {
+		t.Errorf("Expected monthly quota to be used up")
+	}
+	if result, _ := quota.Reserve(ctx, "alice", "free"); result.Allowed || !result.Reset.Equal(monthReset) {
+		t.Errorf("Expected the monthly quota to limit the reservation, got %+v", result)
+	}
+	if n, _ := store.Get(ctx, "alice:day:2025-01-31"); n != 1 {
+		t.Errorf("Expected the daily reservation to be taken back, got count %d", n)
+	}
+
+	if result, _ := quota.Check(ctx, "alice", "unknown"); result.Allowed {
+		t.Errorf("Expected unknown plan to fall back to the default plan")
+	}
+
+	result, err := quota.Reserve(ctx, "alice", "unlimited")
+	if err != nil || !result.Allowed || result.Limited {
+		t.Errorf("Expected unlimited plan to be allowed and not limited, got %+v, err=%v", result, err)
+	}
+
+	if result, _ := quota.Check(ctx, "bob", "free"); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("Expected other subjects to have their own quota, got %+v", result)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 30, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	store.Reserve(ctx, "expiring", 1, now.Add(time.Second))
+	now = now.Add(2 * time.Second)
+
+	// The expired counter was not swept yet, but starts over.
+	if n, reserved, _ := store.Reserve(ctx, "expiring", 1, now.Add(time.Second)); !reserved || n != 1 {
+		t.Errorf("Expected the expired counter to start over, got %d, reserved=%v", n, reserved)
+	}
+
+	now = now.Add(sweepInterval)
+	store.Reserve(ctx, "other", 1, now.Add(time.Hour))
+	if len(store.counters) != 1 {
+		t.Errorf("Expected expired counters to be swept, got %v", store.counters)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "quota.json")
+	expiresAt := time.Now().Add(time.Hour)
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	store.Reserve(ctx, "key", 10, expiresAt)
+	store.Reserve(ctx, "key", 10, expiresAt)
+	store.Reserve(ctx, "released", 10, expiresAt)
+	store.Release(ctx, "released")
+	store.Reserve(ctx, "expired", 10, time.Now().Add(-time.Hour))
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the file to be saved later, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for key, want := range map[string]int64{"key": 2, "released": 0, "expired": 0} {
+		if n, _ := reopened.Get(ctx, key); n != want {
+			t.Errorf("Expected persisted count %d of %s, got %d", want, key, n)
+		}
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	store := NewRedisStore(client)
+	server.SetTime(time.Now())
+
+	if n, err := store.Get(ctx, "key"); err != nil || n != 0 {
+		t.Fatalf("Expected missing key to count 0, got %d, err=%v", n, err)
+	}
+	store.Reserve(ctx, "key", 2, time.Now().Add(time.Hour))
+	if n, ok, err := store.Reserve(ctx, "key", 2, time.Now().Add(time.Hour)); err != nil || !ok || n != 2 {
+		t.Fatalf("Expected count 2, got %d, reserved=%v, err=%v", n, ok, err)
+	}
+	if n, ok, err := store.Reserve(ctx, "key", 2, time.Now().Add(time.Hour)); err != nil || ok || n != 2 {
+		t.Fatalf("Expected the limit to stop the reservation at 2, got %d, reserved=%v, err=%v", n, ok, err)
+	}
+	if err := store.Release(ctx, "key"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if n, _ := store.Get(ctx, "key"); n != 1 {
+		t.Errorf("Expected count 1 after release, got %d", n)
+	}
+
+	server.FastForward(2 * time.Hour)
+	if n, _ := store.Get(ctx, "key"); n != 0 {
+		t.Errorf("Expected expired key to count 0, got %d", n)
+	}
+	store.Release(ctx, "key")
+	if n, _ := store.Get(ctx, "key"); n != 0 {
+		t.Errorf("Expected a release after expiry to keep count 0, got %d", n)
+	}
+}
+
+func TestQuotaConcurrentReserve(t *testing.T) {
+	quota := New(NewMemoryStore(), map[string]Plan{"free": {Daily: 5}})
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if result, err := quota.Reserve(context.Background(), "alice", "free"); err == nil && result.Allowed {
+				allowed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 5 {
+		t.Errorf("Expected exactly 5 reservations, got %d", got)
+	}
+}
@@ -0,0 +1,64 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "img2haiku:quota:"
+
+// reserveScript increments the counter at KEYS[1] unless it has reached
+// ARGV[1], and lets it expire at ARGV[2] in Unix milliseconds. It returns
+// the count and whether it was incremented.
+var reserveScript = redis.NewScript(`
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+if count >= tonumber(ARGV[1]) then
+	return {count, 0}
+end
+count = redis.call("INCR", KEYS[1])
+redis.call("PEXPIREAT", KEYS[1], ARGV[2])
+return {count, 1}
+`)
+
+// releaseScript decrements the counter at KEYS[1] if it is positive, so that
+// a release after expiry does not leave a negative counter behind.
+var releaseScript = redis.NewScript(`
+local count = tonumber(redis.call("GET", KEYS[1]) or "0")
+if count > 0 then
+	redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+// RedisStore is a Store backed by Redis, so that all instances share the same
+// counters.
+type RedisStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	n, err := s.client.Get(ctx, redisKeyPrefix+key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (s *RedisStore) Reserve(ctx context.Context, key string, limit int64, expiresAt time.Time) (int64, bool, error) {
+	result, err := reserveScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, limit, expiresAt.UnixMilli()).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return result[0], result[1] == 1, nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	return releaseScript.Run(ctx, s.client, []string{redisKeyPrefix + key}).Err()
+}
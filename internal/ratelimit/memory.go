@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucket is an in-process Limiter. Its state is not shared between
+// instances.
+type TokenBucket struct {
+	config Config
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewTokenBucket creates a limiter. A Burst below 1 or a Refill below
+// MinRefill is raised to that value.
+func NewTokenBucket(config Config) *TokenBucket {
+	return &TokenBucket{
+		config:  config.clamped(),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *TokenBucket) Allow(_ context.Context, key string) (Decision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.config.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.config.Burst), b.tokens+float64(now.Sub(b.last))/float64(l.config.Refill))
+	b.last = now
+
+	if b.tokens < 1 {
+		return Decision{
+			Allowed:    false,
+			RetryAfter: time.Duration((1 - b.tokens) * float64(l.config.Refill)),
+		}, nil
+	}
+
+	b.tokens--
+	return Decision{Allowed: true, Remaining: int(b.tokens)}, nil
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket is
+// equivalent. It runs at most once per full refill period.
+func (l *TokenBucket) sweep(now time.Time) {
+	fullAfter := time.Duration(l.config.Burst) * l.config.Refill
+	if now.Sub(l.lastSweep) < fullAfter {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= fullAfter {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewTokenBucket(Config{Burst: 2, Refill: 10 * time.Second})
+	limiter.now = func() time.Time { return now }
+
+	steps := []struct {
+		name           string
+		key            string
+		advance        time.Duration
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+	}{
+		{name: "first request", key: "alice", wantAllowed: true, wantRemaining: 1},
+		{name: "second request uses the burst", key: "alice", wantAllowed: true, wantRemaining: 0},
+		{name: "third request is limited", key: "alice", wantAllowed: false, wantRetryAfter: 10 * time.Second},
+		{name: "other subjects have their own bucket", key: "bob", wantAllowed: true, wantRemaining: 1},
+		{name: "partial refill is not enough", key: "alice", advance: 4 * time.Second, wantAllowed: false, wantRetryAfter: 6 * time.Second},
+		{name: "refilled token is allowed", key: "alice", advance: 6 * time.Second, wantAllowed: true, wantRemaining: 0},
+		{name: "bucket does not exceed burst", key: "alice", advance: time.Hour, wantAllowed: true, wantRemaining: 1},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+
+		decision, err := limiter.Allow(ctx, step.key)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", step.name, err)
+		}
+		if decision.Allowed != step.wantAllowed {
+			t.Errorf("%s: expected allowed to be %v, got %v", step.name, step.wantAllowed, decision.Allowed)
+		}
+		if decision.Remaining != step.wantRemaining {
+			t.Errorf("%s: expected %d remaining, got %d", step.name, step.wantRemaining, decision.Remaining)
+		}
+		if decision.RetryAfter != step.wantRetryAfter {
+			t.Errorf("%s: expected retry after %v, got %v", step.name, step.wantRetryAfter, decision.RetryAfter)
+		}
+	}
+}
+
+func TestTokenBucketClampsConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config Config
+	}{
+		{name: "zero refill", config: Config{Burst: 1}},
+		{name: "negative refill", config: Config{Burst: 1, Refill: -time.Second}},
+		{name: "zero burst", config: Config{Refill: time.Minute}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+			limiter := NewTokenBucket(c.config)
+			limiter.now = func() time.Time { return now }
+
+			if decision, _ := limiter.Allow(context.Background(), "alice"); !decision.Allowed {
+				t.Errorf("Expected the first request to be allowed")
+			}
+			if decision, _ := limiter.Allow(context.Background(), "alice"); decision.Allowed {
+				t.Errorf("Expected the second request to be limited, got %+v", decision)
+			}
+		})
+	}
+}
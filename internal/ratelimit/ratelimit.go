@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Config configures a token bucket: a subject may send Burst requests at
+// once and regains one request every Refill.
+type Config struct {
+	Burst  int
+	Refill time.Duration
+}
+
+var DefaultConfig = Config{
+	Burst:  10,
+	Refill: 6 * time.Second,
+}
+
+// MinRefill is the shortest Refill a limiter uses. The Redis limiter counts
+// in milliseconds, and a zero Refill would allow every request.
+const MinRefill = time.Millisecond
+
+// clamped raises Burst and Refill to the smallest values that work, for
+// callers that did not validate the configuration.
+func (c Config) clamped() Config {
+	c.Burst = max(c.Burst, 1)
+	c.Refill = max(c.Refill, MinRefill)
+	return c
+}
+
+// Decision is the outcome of a rate limit check.
+type Decision struct {
+	Allowed bool
+	// Remaining is the number of requests left in the bucket.
+	Remaining int
+	// RetryAfter is how long to wait before the next request is allowed. It
+	// is only set when Allowed is false.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether a request identified by key may proceed.
+// Implementations must be safe for concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Decision, error)
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "img2haiku:ratelimit:"
+
+// tokenBucketScript refills and takes a token from the bucket stored at
+// KEYS[1] in one atomic step. It returns whether the request is allowed, the
+// remaining tokens and the milliseconds until the next token. It reads the
+// time from Redis, so that the clocks of the instances do not matter.
+var tokenBucketScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local refill_ms = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now_ms = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now_ms
+end
+
+tokens = math.min(burst, tokens + math.max(0, now_ms - last) / refill_ms)
+
+local allowed = 0
+local retry_after = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry_after = math.ceil((1 - tokens) * refill_ms)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(now_ms))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * refill_ms))
+
+return {allowed, math.floor(tokens), retry_after}
+`)
+
+// RedisTokenBucket is a Limiter whose buckets live in Redis, so that all
+// instances share the same limits.
+type RedisTokenBucket struct {
+	client redis.Scripter
+	config Config
+}
+
+// NewRedisTokenBucket creates a limiter. A Burst below 1 or a Refill below
+// MinRefill is raised to that value.
+func NewRedisTokenBucket(client redis.Scripter, config Config) *RedisTokenBucket {
+	return &RedisTokenBucket{client: client, config: config.clamped()}
+}
+
+func (l *RedisTokenBucket) Allow(ctx context.Context, key string) (Decision, error) {
+	result, err := tokenBucketScript.Run(ctx, l.client,
+		[]string{redisKeyPrefix + key},
+		l.config.Burst, l.config.Refill.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+
+	return Decision{
+		Allowed:    result[0] == 1,
+		Remaining:  int(result[1]),
+		RetryAfter: time.Duration(result[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	config := Config{Burst: 2, Refill: 10 * time.Second}
+	// Two instances sharing the same Redis share the same buckets, and the
+	// buckets use the clock of Redis, not theirs.
+	instances := []*RedisTokenBucket{NewRedisTokenBucket(client, config), NewRedisTokenBucket(client, config)}
+
+	steps := []struct {
+		name           string
+		key            string
+		advance        time.Duration
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+	}{
+		{name: "first request", key: "alice", wantAllowed: true, wantRemaining: 1},
+		{name: "second request uses the burst", key: "alice", wantAllowed: true, wantRemaining: 0},
+		{name: "third request is limited", key: "alice", wantAllowed: false, wantRetryAfter: 10 * time.Second},
+		{name: "other subjects have their own bucket", key: "bob", wantAllowed: true, wantRemaining: 1},
+		{name: "partial refill is not enough", key: "alice", advance: 4 * time.Second, wantAllowed: false, wantRetryAfter: 6 * time.Second},
+		{name: "refilled token is allowed", key: "alice", advance: 6 * time.Second, wantAllowed: true, wantRemaining: 0},
+		{name: "bucket does not exceed burst", key: "alice", advance: time.Hour, wantAllowed: true, wantRemaining: 1},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		server.SetTime(now)
+
+		decision, err := instances[i%len(instances)].Allow(ctx, step.key)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", step.name, err)
+		}
+		if decision.Allowed != step.wantAllowed {
+			t.Errorf("%s: expected allowed to be %v, got %v", step.name, step.wantAllowed, decision.Allowed)
+		}
+		if decision.Remaining != step.wantRemaining {
+			t.Errorf("%s: expected %d remaining, got %d", step.name, step.wantRemaining, decision.Remaining)
+		}
+		if decision.RetryAfter != step.wantRetryAfter {
+			t.Errorf("%s: expected retry after %v, got %v", step.name, step.wantRetryAfter, decision.RetryAfter)
+		}
+	}
+
+	if ttl := server.TTL(redisKeyPrefix + "alice"); ttl <= 0 {
+		t.Errorf("Expected bucket to expire, got TTL %v", ttl)
+	}
+}
@@ -0,0 +1,143 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore is a Store that persists the token IDs in a JSON object that maps
+// them to their expiry, so that they survive restarts of a single instance.
+// Used tokens are stored with a "used:" prefix. The file may also be written
+// by other tools, preferably by renaming a complete file over it; it is read
+// again whenever it changes.
+type FileStore struct {
+	path string
+
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	modTime   time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewFileStore loads the token IDs from path. A missing file starts with no
+// token IDs.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, entries: make(map[string]time.Time), now: time.Now}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Revoked(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	return revoked(s.entries, id, s.now()), nil
+}
+
+func (s *FileStore) Revoke(_ context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	sweep(s.entries, &s.lastSweep, s.now())
+	revoke(s.entries, id, expiresAt)
+	return s.save()
+}
+
+func (s *FileStore) Used(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	return revoked(s.entries, usedPrefix+id, s.now()), nil
+}
+
+func (s *FileStore) Use(_ context.Context, id string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	now := s.now()
+	sweep(s.entries, &s.lastSweep, now)
+	if !use(s.entries, id, expiresAt, now) {
+		return false, nil
+	}
+	return true, s.save()
+}
+
+// load reads the file if it changed since it was last read or written.
+func (s *FileStore) load() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]time.Time)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	s.entries = entries
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// save writes the token IDs to a temporary file first, so that a crash never
+// leaves a truncated file behind.
+func (s *FileStore) save() error {
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.modTime = info.ModTime()
+	return nil
+}
@@ -0,0 +1,67 @@
+package revocation
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/logging"
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+// maxBodySize is far more than a revocation needs.
+const maxBodySize = 4 << 10
+
+// Request revokes the token with the given jti. ExpiresAt should be the exp
+// claim of the token; without it, the revocation is kept for DefaultTTL.
+type Request struct {
+	ID        string     `json:"jti"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// Handler revokes tokens for admins that send adminToken as a bearer token.
+// With an empty adminToken, every request is rejected.
+func Handler(store Store, adminToken string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+adminToken)) != 1 {
+			writeError(w, r, http.StatusUnauthorized, types.ErrAuthInvalid, "Invalid admin token")
+			return
+		}
+
+		var req Request
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, types.ErrInvalidRequest, "Failed to decode request body: "+err.Error())
+			return
+		}
+		if req.ID == "" {
+			writeError(w, r, http.StatusBadRequest, types.ErrInvalidRequest, "jti is required")
+			return
+		}
+		expiresAt := time.Now().Add(DefaultTTL)
+		if req.ExpiresAt != nil {
+			expiresAt = *req.ExpiresAt
+		}
+
+		if err := store.Revoke(r.Context(), req.ID, expiresAt); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to revoke token", "jti", req.ID, "error", err)
+			writeError(w, r, http.StatusInternalServerError, types.ErrInternalError, "Failed to revoke token: "+err.Error())
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Revoked token", "jti", req.ID, "expiresAt", expiresAt)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code types.ErrorCode, details string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(types.ErrorResponse{
+		Code:      code,
+		Details:   details,
+		RequestID: logging.RequestID(r.Context()),
+	})
+}
@@ -0,0 +1,52 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store. Revocations are lost on restart and are
+// not shared between instances.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]time.Time), now: time.Now}
+}
+
+func (s *MemoryStore) Revoked(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return revoked(s.entries, id, s.now()), nil
+}
+
+func (s *MemoryStore) Revoke(_ context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sweep(s.entries, &s.lastSweep, s.now())
+	revoke(s.entries, id, expiresAt)
+	return nil
+}
+
+func (s *MemoryStore) Used(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return revoked(s.entries, usedPrefix+id, s.now()), nil
+}
+
+func (s *MemoryStore) Use(_ context.Context, id string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	sweep(s.entries, &s.lastSweep, now)
+	return use(s.entries, id, expiresAt, now), nil
+}
@@ -0,0 +1,72 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix     = "img2haiku:revocation:"
+	redisUsedKeyPrefix = "img2haiku:used:"
+)
+
+// revokeScript stores the expiry ARGV[1], in Unix milliseconds, at KEYS[1]
+// and lets the key expire then, unless a later expiry is stored already.
+var revokeScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if tonumber(ARGV[1]) > current then
+	redis.call("SET", KEYS[1], ARGV[1], "PXAT", ARGV[1])
+end
+return 0
+`)
+
+// RedisStore is a Store backed by Redis, so that all instances share the
+// revoked and used tokens.
+type RedisStore struct {
+	client redis.Cmdable
+	now    func() time.Time
+}
+
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client, now: time.Now}
+}
+
+func (s *RedisStore) Revoked(ctx context.Context, id string) (bool, error) {
+	n, err := s.client.Exists(ctx, redisKeyPrefix+id).Result()
+	return n > 0, err
+}
+
+func (s *RedisStore) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	if !expiresAt.After(s.now()) {
+		// The token is expired, so there is nothing left to deny.
+		return nil
+	}
+	return revokeScript.Run(ctx, s.client, []string{redisKeyPrefix + id}, expiresAt.UnixMilli()).Err()
+}
+
+func (s *RedisStore) Used(ctx context.Context, id string) (bool, error) {
+	n, err := s.client.Exists(ctx, redisUsedKeyPrefix+id).Result()
+	return n > 0, err
+}
+
+func (s *RedisStore) Use(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	if revoked, err := s.Revoked(ctx, id); err != nil || revoked {
+		return false, err
+	}
+	if !expiresAt.After(s.now()) {
+		// Like the other stores, nothing is kept for an expired token.
+		return true, nil
+	}
+	err := s.client.SetArgs(ctx, redisUsedKeyPrefix+id, strconv.FormatInt(expiresAt.UnixMilli(), 10), redis.SetArgs{
+		Mode:     "NX",
+		ExpireAt: expiresAt,
+	}).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,72 @@
+// Package revocation denies tokens by their jti claim before they expire,
+// and optionally allows short-lived tokens to be used only once.
+package revocation
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTTL is how long a revocation is kept if it names no expiry. It must
+// outlast the tokens it revokes.
+const DefaultTTL = 24 * time.Hour
+
+// sweepInterval is how often expired entries are dropped.
+const sweepInterval = time.Minute
+
+// usedPrefix sets the markers of used tokens apart from revocations, which
+// are keyed by the bare token ID.
+const usedPrefix = "used:"
+
+// Store keeps the IDs of revoked and used tokens until the tokens expire.
+// Revocations and the markers of used tokens are kept apart, so that a
+// revoked token can be rejected even where a used one is still accepted.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Revoked reports whether the token with the given ID was revoked.
+	Revoked(ctx context.Context, id string) (bool, error)
+	// Revoke denies the token with the given ID until expiresAt.
+	Revoke(ctx context.Context, id string, expiresAt time.Time) error
+	// Used reports whether the token with the given ID was used before.
+	Used(ctx context.Context, id string) (bool, error)
+	// Use atomically marks the token with the given ID as used until
+	// expiresAt. It reports false if the token was revoked or used before.
+	Use(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+}
+
+func revoked(entries map[string]time.Time, key string, now time.Time) bool {
+	expiresAt, ok := entries[key]
+	return ok && now.Before(expiresAt)
+}
+
+// revoke adds key to entries. A later expiry is kept if the key is there
+// already.
+func revoke(entries map[string]time.Time, key string, expiresAt time.Time) {
+	if expiresAt.After(entries[key]) {
+		entries[key] = expiresAt
+	}
+}
+
+// use marks id as used unless it was revoked or used before.
+func use(entries map[string]time.Time, id string, expiresAt, now time.Time) bool {
+	if revoked(entries, id, now) || revoked(entries, usedPrefix+id, now) {
+		return false
+	}
+	revoke(entries, usedPrefix+id, expiresAt)
+	return true
+}
+
+// sweep drops expired entries. It runs at most once per sweepInterval after
+// lastSweep to keep Revoke and Use cheap.
+func sweep(entries map[string]time.Time, lastSweep *time.Time, now time.Time) {
+	if now.Sub(*lastSweep) < sweepInterval {
+		return
+	}
+	*lastSweep = now
+
+	for k, e := range entries {
+		if !now.Before(e) {
+			delete(entries, k)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rd-martin-zoeller/img2haiku-backend/internal/types"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	if revoked, err := store.Revoked(ctx, "EXAMPLE_ID"); err != nil || revoked {
+		t.Fatalf("Expected unknown token not to be revoked, got %v, err=%v", revoked, err)
+	}
+
+	store.Revoke(ctx, "EXAMPLE_ID", now.Add(15*time.Minute))
+	if revoked, _ := store.Revoked(ctx, "EXAMPLE_ID"); !revoked {
+		t.Errorf("Expected token to be revoked")
+	}
+	if first, _ := store.Use(ctx, "EXAMPLE_ID", now.Add(15*time.Minute)); first {
+		t.Errorf("Expected revoked token not to be usable")
+	}
+
+	if first, _ := store.Use(ctx, "EXAMPLE_OTHER_ID", now.Add(time.Minute)); !first {
+		t.Errorf("Expected first use of a token")
+	}
+	if first, _ := store.Use(ctx, "EXAMPLE_OTHER_ID", now.Add(time.Minute)); first {
+		t.Errorf("Expected second use of a token to be rejected")
+	}
+	if used, _ := store.Used(ctx, "EXAMPLE_OTHER_ID"); !used {
+		t.Errorf("Expected token to be used")
+	}
+	if revoked, _ := store.Revoked(ctx, "EXAMPLE_OTHER_ID"); revoked {
+		t.Errorf("Expected used token not to be revoked")
+	}
+
+	now = now.Add(15 * time.Minute)
+	if revoked, _ := store.Revoked(ctx, "EXAMPLE_ID"); revoked {
+		t.Errorf("Expected revocation to end when the token expires")
+	}
+	store.Revoke(ctx, "EXAMPLE_THIRD_ID", now.Add(time.Minute))
+	if len(store.entries) != 1 {
+		t.Errorf("Expected expired entries to be dropped, got %v", store.entries)
+	}
+
+	// Expired entries are swept at most once a minute.
+	now = now.Add(2 * time.Minute)
+	store.Revoke(ctx, "EXAMPLE_FOURTH_ID", now.Add(time.Minute))
+	store.Revoke(ctx, "EXAMPLE_FIFTH_ID", now.Add(time.Minute))
+	if len(store.entries) != 2 {
+		t.Errorf("Expected expired entries to be dropped, got %v", store.entries)
+	}
+	store.Use(ctx, "EXAMPLE_SIXTH_ID", now.Add(time.Minute))
+	now = now.Add(time.Minute)
+	if revoked, _ := store.Revoked(ctx, "EXAMPLE_FOURTH_ID"); revoked {
+		t.Errorf("Expected an expired revocation to end before it is swept")
+	}
+	if first, _ := store.Use(ctx, "EXAMPLE_SIXTH_ID", now.Add(time.Minute)); !first {
+		t.Errorf("Expected an expired use to be forgotten before it is swept")
+	}
+}
+
+func TestMemoryStoreConcurrentUse(t *testing.T) {
+	store := NewMemoryStore()
+	expiresAt := time.Now().Add(time.Minute)
+
+	var firsts atomic.Int32
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Go(func() {
+			if first, _ := store.Use(context.Background(), "EXAMPLE_ID", expiresAt); first {
+				firsts.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := firsts.Load(); got != 1 {
+		t.Errorf("Expected exactly 1 first use, got %d", got)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "revocations.json")
+	expiresAt := time.Now().Add(time.Hour)
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	store.Revoke(ctx, "EXAMPLE_ID", expiresAt)
+	store.Use(ctx, "EXAMPLE_USED_ID", expiresAt)
+	store.Revoke(ctx, "EXAMPLE_EXPIRED_ID", time.Now().Add(-time.Hour))
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for id, want := range map[string]bool{"EXAMPLE_ID": true, "EXAMPLE_USED_ID": false, "EXAMPLE_EXPIRED_ID": false} {
+		if revoked, err := reopened.Revoked(ctx, id); err != nil || revoked != want {
+			t.Errorf("Expected %s revoked to be %v, got %v, err=%v", id, want, revoked, err)
+		}
+	}
+	if used, err := reopened.Used(ctx, "EXAMPLE_USED_ID"); err != nil || !used {
+		t.Errorf("Expected EXAMPLE_USED_ID to be used, got %v, err=%v", used, err)
+	}
+
+	// Another tool revokes a token by replacing the file.
+	data, _ := json.Marshal(map[string]time.Time{"EXAMPLE_FED_ID": expiresAt})
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(tmp, later, later)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Failed to replace file: %v", err)
+	}
+
+	if revoked, err := reopened.Revoked(ctx, "EXAMPLE_FED_ID"); err != nil || !revoked {
+		t.Errorf("Expected the changed file to be read, got %v, err=%v", revoked, err)
+	}
+}
+
+func TestFileStoreMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+	if err := os.WriteFile(path, []byte("EXAMPLE_ID"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, err := NewFileStore(path); err == nil {
+		t.Errorf("Expected an error for a malformed file")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	now := time.Now()
+	server.SetTime(now)
+	store := NewRedisStore(client)
+	store.now = func() time.Time { return now }
+
+	if revoked, err := store.Revoked(ctx, "EXAMPLE_ID"); err != nil || revoked {
+		t.Fatalf("Expected unknown token not to be revoked, got %v, err=%v", revoked, err)
+	}
+
+	store.Revoke(ctx, "EXAMPLE_ID", now.Add(time.Hour))
+	// A shorter expiry does not shorten the revocation.
+	store.Revoke(ctx, "EXAMPLE_ID", now.Add(time.Minute))
+	if revoked, _ := store.Revoked(ctx, "EXAMPLE_ID"); !revoked {
+		t.Errorf("Expected token to be revoked")
+	}
+	if first, _ := store.Use(ctx, "EXAMPLE_ID", now.Add(time.Minute)); first {
+		t.Errorf("Expected revoked token not to be usable")
+	}
+
+	if first, err := store.Use(ctx, "EXAMPLE_OTHER_ID", now.Add(time.Minute)); err != nil || !first {
+		t.Errorf("Expected first use of a token, got %v, err=%v", first, err)
+	}
+	if first, _ := store.Use(ctx, "EXAMPLE_OTHER_ID", now.Add(time.Minute)); first {
+		t.Errorf("Expected second use of a token to be rejected")
+	}
+	if used, _ := store.Used(ctx, "EXAMPLE_OTHER_ID"); !used {
+		t.Errorf("Expected token to be used")
+	}
+	if revoked, _ := store.Revoked(ctx, "EXAMPLE_OTHER_ID"); revoked {
+		t.Errorf("Expected used token not to be revoked")
+	}
+
+	server.FastForward(30 * time.Minute)
+	if used, _ := store.Used(ctx, "EXAMPLE_OTHER_ID"); used {
+		t.Errorf("Expected the use to be forgotten when the token expires")
+	}
+	if revoked, _ := store.Revoked(ctx, "EXAMPLE_ID"); !revoked {
+		t.Errorf("Expected the revocation to keep its later expiry")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	expiresAt := time.Now().Add(15 * time.Minute).UTC().Truncate(time.Second)
+
+	cases := []struct {
+		name       string
+		adminToken string
+		auth       string
+		body       string
+		wantStatus int
+		wantCode   types.ErrorCode
+		wantID     string
+	}{
+		{name: "revoke", adminToken: "EXAMPLE_ADMIN_TOKEN", auth: "Bearer EXAMPLE_ADMIN_TOKEN", body: `{"jti": "EXAMPLE_ID", "expiresAt": "` + expiresAt.Format(time.RFC3339) + `"}`, wantStatus: http.StatusNoContent, wantID: "EXAMPLE_ID"},
+		{name: "revoke without expiry", adminToken: "EXAMPLE_ADMIN_TOKEN", auth: "Bearer EXAMPLE_ADMIN_TOKEN", body: `{"jti": "EXAMPLE_ID"}`, wantStatus: http.StatusNoContent, wantID: "EXAMPLE_ID"},
+		{name: "wrong admin token", adminToken: "EXAMPLE_ADMIN_TOKEN", auth: "Bearer EXAMPLE_OTHER_TOKEN", body: `{"jti": "EXAMPLE_ID"}`, wantStatus: http.StatusUnauthorized, wantCode: types.ErrAuthInvalid},
+		{name: "no admin token configured", auth: "Bearer ", body: `{"jti": "EXAMPLE_ID"}`, wantStatus: http.StatusUnauthorized, wantCode: types.ErrAuthInvalid},
+		{name: "missing jti", adminToken: "EXAMPLE_ADMIN_TOKEN", auth: "Bearer EXAMPLE_ADMIN_TOKEN", body: `{}`, wantStatus: http.StatusBadRequest, wantCode: types.ErrInvalidRequest},
+		{name: "malformed body", adminToken: "EXAMPLE_ADMIN_TOKEN", auth: "Bearer EXAMPLE_ADMIN_TOKEN", body: `EXAMPLE_ID`, wantStatus: http.StatusBadRequest, wantCode: types.ErrInvalidRequest},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := NewMemoryStore()
+			r := httptest.NewRequest(http.MethodPost, "/admin/revocations", strings.NewReader(c.body))
+			r.Header.Set("Authorization", c.auth)
+			w := httptest.NewRecorder()
+
+			Handler(store, c.adminToken)(w, r)
+
+			if w.Code != c.wantStatus {
+				t.Fatalf("Expected status %d, got %d", c.wantStatus, w.Code)
+			}
+			if c.wantCode != "" {
+				var errorResponse types.ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&errorResponse); err != nil {
+					t.Fatalf("Failed to decode error response: %v", err)
+				}
+				if errorResponse.Code != c.wantCode {
+					t.Errorf("Expected error code %s, got %s", c.wantCode, errorResponse.Code)
+				}
+			}
+			if c.wantID != "" {
+				if revoked, _ := store.Revoked(context.Background(), c.wantID); !revoked {
+					t.Errorf("Expected %s to be revoked", c.wantID)
+				}
+			}
+		})
+	}
+}
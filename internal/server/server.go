@@ -0,0 +1,125 @@
+// Package server runs a handler as a standalone HTTP server, without the
+// Functions Framework.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+type Config struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout bounds reading a whole request, including the image.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds serving a request and must leave room for the
+	// upstream call.
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// once the server is stopped.
+	ShutdownTimeout time.Duration
+	// TLSCertFile and TLSKeyFile enable HTTPS if both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// DefaultConfig leaves enough time for the 30s upstream call both while
+// serving and while draining.
+var DefaultConfig = Config{
+	Addr:              ":8080",
+	ReadHeaderTimeout: 10 * time.Second,
+	ReadTimeout:       30 * time.Second,
+	WriteTimeout:      60 * time.Second,
+	IdleTimeout:       120 * time.Second,
+	ShutdownTimeout:   45 * time.Second,
+}
+
+func (c Config) validate() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("both a TLS certificate and key file are required for HTTPS")
+	}
+	return nil
+}
+
+// Run listens on config.Addr and serves handler until ctx is done.
+func Run(ctx context.Context, handler http.Handler, config Config) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", config.Addr, err)
+	}
+	return Serve(ctx, ln, handler, config)
+}
+
+// Serve serves handler on ln until ctx is done. It then stops accepting
+// connections and waits up to config.ShutdownTimeout for in-flight requests
+// to finish.
+func Serve(ctx context.Context, ln net.Listener, handler http.Handler, config Config) error {
+	if err := config.validate(); err != nil {
+		ln.Close()
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		// Requests must not be cancelled when ctx is, so that they can
+		// drain.
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithoutCancel(ctx)
+		},
+	}
+
+	tlsEnabled := config.TLSCertFile != ""
+	if tlsEnabled {
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "addr", ln.Addr().String(), "tls", tlsEnabled)
+		if tlsEnabled {
+			errs <- srv.ServeTLS(ln, "", "")
+		} else {
+			errs <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, draining in-flight requests", "timeout", config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("failed to drain in-flight requests: %w", err)
+	}
+
+	slog.Info("Server stopped")
+	return nil
+}
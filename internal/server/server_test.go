@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	url := "http://" + ln.Addr().String()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		if err := r.Context().Err(); err != nil {
+			t.Errorf("Expected the request context to stay alive while draining, got %v", err)
+		}
+		w.Write([]byte("EXAMPLE_HAIKU"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	config := DefaultConfig
+	config.ShutdownTimeout = 5 * time.Second
+
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, ln, handler, config) }()
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Errorf("Failed to get in-flight response: %v", err)
+			responses <- ""
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-served:
+		t.Fatalf("Expected Serve to wait for the in-flight request, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("Expected new connections to be refused while draining")
+	}
+
+	close(release)
+	if body := <-responses; body != "EXAMPLE_HAIKU" {
+		t.Errorf("Expected the in-flight request to complete, got %q", body)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	config := DefaultConfig
+	config.ShutdownTimeout = 50 * time.Millisecond
+
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, ln, handler, config) }()
+	go http.Get("http://" + ln.Addr().String())
+
+	<-started
+	cancel()
+
+	if err := <-served; err == nil {
+		t.Errorf("Expected an error when in-flight requests outlast the shutdown timeout")
+	}
+}
+
+func TestServeRequiresCertAndKey(t *testing.T) {
+	cases := []struct {
+		name   string
+		config Config
+	}{
+		{name: "certificate only", config: Config{TLSCertFile: "EXAMPLE_CERT"}},
+		{name: "key only", config: Config{TLSKeyFile: "EXAMPLE_KEY"}},
+		{name: "missing files", config: Config{TLSCertFile: "EXAMPLE_CERT", TLSKeyFile: "EXAMPLE_KEY"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+
+			if err := Serve(context.Background(), ln, http.NotFoundHandler(), c.config); err == nil {
+				t.Errorf("Expected an error for an incomplete TLS configuration")
+			}
+		})
+	}
+}
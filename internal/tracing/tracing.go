@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies this service in traces.
+const ServiceName = "img2haiku-backend"
+
+const instrumentationName = "github.com/rd-martin-zoeller/img2haiku-backend"
+
+// Exporter selects where spans are sent.
+type Exporter string
+
+const (
+	// ExporterNone records no spans, but still propagates incoming trace
+	// context to the upstream calls.
+	ExporterNone Exporter = "none"
+	// ExporterStdout writes spans as JSON, e.g. for local runs.
+	ExporterStdout Exporter = "stdout"
+	// ExporterOTLP sends spans to an OTLP/HTTP collector.
+	ExporterOTLP Exporter = "otlp"
+)
+
+type Config struct {
+	Exporter Exporter
+	// Endpoint is the OTLP/HTTP endpoint URL, e.g.
+	// http://localhost:4318/v1/traces. If empty, the standard
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variables apply.
+	Endpoint string
+	// Stdout receives the spans of ExporterStdout. os.Stdout is used if nil.
+	Stdout io.Writer
+}
+
+// Setup installs the global tracer provider and W3C trace context
+// propagation. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		opts := []stdouttrace.Option{}
+		if config.Stdout != nil {
+			opts = append(opts, stdouttrace.WithWriter(config.Stdout))
+		}
+		exporter, err = stdouttrace.New(opts...)
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if config.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(config.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter %q, must be one of: none, stdout, otlp", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", config.Exporter, err)
+	}
+
+	provider := NewTracerProvider(exporter)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider returns a provider that batches spans to exporter and
+// follows the sampling decision of incoming requests.
+func NewTracerProvider(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+}
+
+// Handler starts a server span for each request, continuing the trace of an
+// incoming traceparent header.
+func Handler(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "ComposeHaiku")
+}
+
+// Transport wraps base with client spans for outgoing requests. The spans
+// carry events for when the request was written and when the first
+// response byte arrived, which separates upload time from model time.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base,
+		otelhttp.WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace {
+			return otelhttptrace.NewClientTrace(ctx, otelhttptrace.WithoutSubSpans())
+		}),
+	)
+}
+
+// Start starts a span from the global tracer provider. The provider is looked
+// up on each call so that spans follow a provider installed later.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	exampleTraceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	exampleParentSpanID = "00f067aa0ba902b7"
+)
+
+// useRecorder installs a tracer provider that records spans synchronously.
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	if _, err := Setup(context.Background(), Config{Exporter: ExporterNone}); err != nil {
+		t.Fatalf("Failed to set up propagation: %v", err)
+	}
+	return recorder
+}
+
+func TestHandlerAndTransport(t *testing.T) {
+	recorder := useRecorder(t)
+
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodPost, upstream.URL, strings.NewReader("EXAMPLE_IMAGE"))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Failed to call upstream: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("traceparent", "00-"+exampleTraceID+"-"+exampleParentSpanID+"-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected a server and a client span, got %d spans", len(spans))
+	}
+
+	var server, clientSpan sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.SpanKind() {
+		case trace.SpanKindServer:
+			server = span
+		case trace.SpanKindClient:
+			clientSpan = span
+		}
+	}
+	if server == nil || clientSpan == nil {
+		t.Fatalf("Expected a server and a client span, got %v", spans)
+	}
+
+	if got := server.SpanContext().TraceID().String(); got != exampleTraceID {
+		t.Errorf("Expected the server span to continue trace %s, got %s", exampleTraceID, got)
+	}
+	if got := server.Parent().SpanID().String(); got != exampleParentSpanID {
+		t.Errorf("Expected the server span's parent to be %s, got %s", exampleParentSpanID, got)
+	}
+	if clientSpan.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("Expected the client span to be a child of the server span")
+	}
+	if !strings.Contains(upstreamTraceparent, exampleTraceID) {
+		t.Errorf("Expected upstream traceparent to carry trace %s, got %q", exampleTraceID, upstreamTraceparent)
+	}
+	if len(clientSpan.Events()) == 0 {
+		t.Errorf("Expected the client span to carry connection and request events")
+	}
+}
+
+func TestEnd(t *testing.T) {
+	recorder := useRecorder(t)
+	tracer := otel.Tracer("test")
+
+	_, ok := tracer.Start(context.Background(), "EXAMPLE_OK")
+	End(ok, nil)
+	_, failed := tracer.Start(context.Background(), "EXAMPLE_FAILED")
+	End(failed, errors.New("EXAMPLE_ERROR"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if got := spans[0].Status().Code; got != codes.Unset {
+		t.Errorf("Expected status Unset without an error, got %v", got)
+	}
+	if got := spans[1].Status(); got.Code != codes.Error || got.Description != "EXAMPLE_ERROR" {
+		t.Errorf("Expected status Error with the error message, got %+v", got)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	cases := []struct {
+		name     string
+		exporter Exporter
+		wantErr  bool
+	}{
+		{name: "default", exporter: ""},
+		{name: "none", exporter: ExporterNone},
+		{name: "stdout", exporter: ExporterStdout},
+		{name: "otlp", exporter: ExporterOTLP},
+		{name: "unsupported", exporter: "EXAMPLE_EXPORTER", wantErr: true},
+	}
+
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	for _, c := range cases {
+		var out bytes.Buffer
+		shutdown, err := Setup(context.Background(), Config{
+			Exporter: c.exporter,
+			Endpoint: "http://127.0.0.1:0/v1/traces",
+			Stdout:   &out,
+		})
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%s: expected error %v, got %v", c.name, c.wantErr, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if c.exporter == ExporterStdout {
+			_, span := otel.Tracer("test").Start(context.Background(), "EXAMPLE_SPAN")
+			span.End()
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("%s: failed to shut down: %v", c.name, err)
+		}
+		if c.exporter == ExporterStdout && !strings.Contains(out.String(), "EXAMPLE_SPAN") {
+			t.Errorf("Expected the stdout exporter to write the span, got %q", out.String())
+		}
+	}
+}
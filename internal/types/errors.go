@@ -1,22 +1,47 @@
 package types
 
+import "net/http"
+
 type ErrorCode string
 
 const (
 	ErrInvalidRequest ErrorCode = "INVALID_REQUEST"
 	ErrInternalError  ErrorCode = "INTERNAL_ERROR"
 	ErrAuthExpired    ErrorCode = "AUTH_EXPIRED"
+	ErrRateLimited    ErrorCode = "RATE_LIMITED"
+	ErrQuotaExceeded  ErrorCode = "QUOTA_EXCEEDED"
+
+	ErrBudgetExhausted ErrorCode = "BUDGET_EXHAUSTED"
+
+	// Token errors other than AUTH_EXPIRED.
+	ErrAuthInvalid         ErrorCode = "AUTH_INVALID"
+	ErrAuthNotYetValid     ErrorCode = "AUTH_NOT_YET_VALID"
+	ErrAuthTooOld          ErrorCode = "AUTH_TOO_OLD"
+	ErrAuthInvalidIssuer   ErrorCode = "AUTH_INVALID_ISSUER"
+	ErrAuthInvalidAudience ErrorCode = "AUTH_INVALID_AUDIENCE"
+	ErrAuthMissingClaim    ErrorCode = "AUTH_MISSING_CLAIM"
+	// ErrAuthRevoked is returned for revoked tokens and for one-time tokens
+	// that were used before.
+	ErrAuthRevoked ErrorCode = "AUTH_REVOKED"
+	// ErrForbidden is returned for valid tokens that lack a scope.
+	ErrForbidden ErrorCode = "FORBIDDEN"
+
+	ErrIdempotencyKeyReused  ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	ErrIdempotencyInProgress ErrorCode = "IDEMPOTENCY_IN_PROGRESS"
 )
 
 type ErrorResponse struct {
-	Code    ErrorCode `json:"code"`
-	Details string    `json:"details"`
+	Code      ErrorCode `json:"code"`
+	Details   string    `json:"details"`
+	RequestID string    `json:"requestId,omitempty"`
 }
 
 type ComposeError struct {
 	StatusCode int
 	Code       ErrorCode
 	Details    string
+	// Header is added to the error response, e.g. Retry-After.
+	Header http.Header
 }
 
 func (e *ComposeError) Error() string {
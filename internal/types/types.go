@@ -2,17 +2,173 @@ package types
 
 import "context"
 
+type Tone string
+
+const (
+	ToneAuto        Tone = "auto"
+	TonePlayful     Tone = "playful"
+	ToneSolemn      Tone = "solemn"
+	ToneRomantic    Tone = "romantic"
+	ToneMelancholic Tone = "melancholic"
+	ToneMinimalist  Tone = "minimalist"
+)
+
+var Tones = []Tone{ToneAuto, TonePlayful, ToneSolemn, ToneRomantic, ToneMelancholic, ToneMinimalist}
+
+func (t Tone) Valid() bool {
+	for _, tone := range Tones {
+		if t == tone {
+			return true
+		}
+	}
+	return false
+}
+
+type Season string
+
+const (
+	SeasonSpring Season = "spring"
+	SeasonSummer Season = "summer"
+	SeasonAutumn Season = "autumn"
+	SeasonWinter Season = "winter"
+)
+
+var Seasons = []Season{SeasonSpring, SeasonSummer, SeasonAutumn, SeasonWinter}
+
+func (s Season) Valid() bool {
+	for _, season := range Seasons {
+		if s == season {
+			return true
+		}
+	}
+	return false
+}
+
+type Hemisphere string
+
+const (
+	HemisphereNorthern Hemisphere = "northern"
+	HemisphereSouthern Hemisphere = "southern"
+)
+
+func (h Hemisphere) Valid() bool {
+	return h == HemisphereNorthern || h == HemisphereSouthern
+}
+
+type DuplicatePolicy string
+
+const (
+	// DuplicateReuse returns the earlier haiku for a near-identical image.
+	DuplicateReuse DuplicatePolicy = "reuse"
+	// DuplicateVary composes a new haiku that deliberately differs from the
+	// earlier one.
+	DuplicateVary DuplicatePolicy = "vary"
+)
+
+func (p DuplicatePolicy) Valid() bool {
+	return p == DuplicateReuse || p == DuplicateVary
+}
+
+// ImageDetail is the resolution at which the model looks at the image.
+type ImageDetail string
+
+const (
+	DetailAuto ImageDetail = "auto"
+	DetailLow  ImageDetail = "low"
+	// DetailHigh costs considerably more image tokens.
+	DetailHigh ImageDetail = "high"
+)
+
+var ImageDetails = []ImageDetail{DetailAuto, DetailLow, DetailHigh}
+
+func (d ImageDetail) Valid() bool {
+	return d == DetailAuto || d == DetailLow || d == DetailHigh
+}
+
 type ComposeRequest struct {
-	Language    string   `json:"language"`
-	Tags        []string `json:"tags"`
-	Base64Image string   `json:"base64Image"`
+	Language    string          `json:"language"`
+	Tags        []string        `json:"tags"`
+	Tone        Tone            `json:"tone"`
+	Kigo        bool            `json:"kigo"`
+	Season      Season          `json:"season"`
+	Hemisphere  Hemisphere      `json:"hemisphere"`
+	OnDuplicate DuplicatePolicy `json:"onDuplicate"`
+	Detail      ImageDetail     `json:"detail"`
+	IncludeMeta bool            `json:"includeMeta"`
+	Base64Image string          `json:"base64Image"`
 }
 
+type CacheStatus string
+
+const (
+	CacheHit    CacheStatus = "HIT"
+	CacheMiss   CacheStatus = "MISS"
+	CacheBypass CacheStatus = "BYPASS"
+	// CacheNearHit marks a haiku reused for a near-identical image.
+	CacheNearHit CacheStatus = "NEAR-HIT"
+)
+
 type Haiku struct {
+	Title       string `json:"title"`
 	Haiku       string `json:"haiku"`
 	Description string `json:"description"`
+	AltText     string `json:"altText"`
+	Tone        Tone   `json:"tone,omitempty"`
+	Kigo        string `json:"kigo,omitempty"`
+	Season      Season `json:"season,omitempty"`
+
+	// Meta reports the upstream usage behind the haiku. It is only sent to
+	// clients that ask for it.
+	Meta *Meta `json:"meta,omitempty"`
+
+	// Cache reports how a caching client served the haiku. It is sent as a
+	// response header rather than in the body.
+	Cache CacheStatus `json:"-"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	// ImageTokens are the part of PromptTokens spent on the image, if the
+	// API reports them.
+	ImageTokens int `json:"imageTokens"`
+	TotalTokens int `json:"totalTokens"`
+}
+
+type Meta struct {
+	Model            string  `json:"model,omitempty"`
+	Usage            Usage   `json:"usage"`
+	EstimatedCostUSD float64 `json:"estimatedCostUsd"`
 }
 
 type Client interface {
 	Call(ctx context.Context, prompt, base64Image string) (Haiku, error)
 }
+
+// CallInfo describes the compose request behind a Client call, so that
+// decorators can key or label upstream calls without parsing the prompt.
+type CallInfo struct {
+	Subject       string
+	Language      string
+	Tags          []string
+	Tone          Tone
+	Kigo          bool
+	Season        Season
+	OnDuplicate   DuplicatePolicy
+	Detail        ImageDetail
+	PromptVersion string
+	NoCache       bool
+	// Model overrides the upstream model, e.g. to fall back to a cheaper one.
+	Model string
+}
+
+type callInfoKey struct{}
+
+func WithCallInfo(ctx context.Context, info CallInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+func CallInfoFromContext(ctx context.Context) (CallInfo, bool) {
+	info, ok := ctx.Value(callInfoKey{}).(CallInfo)
+	return info, ok
+}